@@ -0,0 +1,141 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package webserver
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/thalesfsp/webserver/internal/middleware"
+	"github.com/thalesfsp/webserver/telemetry"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+//////
+// Consts, and vars.
+//////
+
+const (
+	defaultClientBackoff    = 100 * time.Millisecond
+	defaultClientMaxBackoff = 10 * time.Second
+	defaultClientRetries    = 2
+	defaultClientTimeout    = 10 * time.Second
+)
+
+//////
+// Options.
+//////
+
+// HTTP client settings.
+type clientConfig struct {
+	backoff    time.Duration
+	maxBackoff time.Duration
+	retries    int
+	timeout    time.Duration
+	transport  http.RoundTripper
+}
+
+// ClientOption allows to specify HTTP client options.
+type ClientOption func(c *clientConfig)
+
+// WithClientTimeout sets the max duration of each attempt, default: 10s. The
+// deadline of the request context, e.g.: the inbound request one, takes
+// precedence. Set to 0 to only be bounded by it.
+func WithClientTimeout(timeout time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.timeout = timeout
+	}
+}
+
+// WithClientRetries sets how many times failed, or unavailable idempotent
+// requests are retried, and the initial backoff, doubled at every retry,
+// default: 2, and 100ms. Set `retries` to 0 to disable.
+func WithClientRetries(retries int, backoff time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithClientMaxBackoff sets the max wait before a retry, default: 10s. Retries
+// the server asks to wait longer for (`Retry-After`) aren't attempted.
+func WithClientMaxBackoff(max time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.maxBackoff = max
+	}
+}
+
+// WithClientTransport sets the underlying transport, default:
+// `http.DefaultTransport`.
+func WithClientTransport(transport http.RoundTripper) ClientOption {
+	return func(c *clientConfig) {
+		c.transport = transport
+	}
+}
+
+//////
+// Factory.
+//////
+
+// NewHTTPClient returns a client to call other services. If telemetry is
+// enabled, requests are traced, and the trace context is propagated. If
+// metrics are enabled, the client RED metrics are published in the server
+// registry.
+//
+// NOTE: Send requests with the inbound request context, so they don't outlive
+// it, e.g.: `http.NewRequestWithContext(r.Context(), ...)`.
+func (s *Server) NewHTTPClient(opts ...ClientOption) *http.Client {
+	c := &clientConfig{
+		backoff:    defaultClientBackoff,
+		maxBackoff: defaultClientMaxBackoff,
+		retries:    defaultClientRetries,
+		timeout:    defaultClientTimeout,
+		transport:  http.DefaultTransport,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	transport := c.transport
+
+	if s.EnableTelemetry {
+		// Spans are created, and propagated by the server telemetry, not the
+		// global one.
+		var otelhttpOptions []otelhttp.Option
+
+		if t, ok := s.GetTelemetry().(*telemetry.Telemetry); ok {
+			if t.Provider != nil {
+				otelhttpOptions = append(otelhttpOptions, otelhttp.WithTracerProvider(t.Provider))
+			}
+
+			if len(t.TextMapPropagator) > 0 {
+				otelhttpOptions = append(otelhttpOptions, otelhttp.WithPropagators(
+					propagation.NewCompositeTextMapPropagator(t.TextMapPropagator...),
+				))
+			}
+		}
+
+		// Every attempt is a span.
+		transport = otelhttp.NewTransport(transport, otelhttpOptions...)
+	}
+
+	var onRetry func(r *http.Request)
+
+	if s.clientMetrics != nil {
+		onRetry = func(r *http.Request) {
+			s.clientMetrics.Retries.Add(1, r.Method, r.URL.Host)
+		}
+	}
+
+	transport = middleware.Retry(transport, c.timeout, c.retries, c.backoff, c.maxBackoff, onRetry)
+
+	if s.clientMetrics != nil {
+		transport = middleware.ClientMetrics(s.clientMetrics, transport)
+	}
+
+	return &http.Client{Transport: transport}
+}
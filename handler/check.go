@@ -0,0 +1,180 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//////
+// Consts, and vars.
+//////
+
+// CheckStatus is the status of a check.
+type CheckStatus string
+
+const (
+	// CheckStatusOK indicates the check passed.
+	CheckStatusOK CheckStatus = "ok"
+
+	// CheckStatusDegraded indicates only non-critical checks failed.
+	CheckStatusDegraded CheckStatus = "degraded"
+
+	// CheckStatusFail indicates the check failed.
+	CheckStatusFail CheckStatus = "fail"
+)
+
+//////
+// Definitions.
+//////
+
+// CheckFunc actively determines readiness, or liveness. It should return as
+// soon as `ctx` is done.
+type CheckFunc func(ctx context.Context) error
+
+// CheckResult is the result of a check.
+type CheckResult struct {
+	// CheckedAt is when the check ran.
+	CheckedAt time.Time `json:"checked_at"`
+
+	// Critical checks affect the final state.
+	Critical bool `json:"critical"`
+
+	// LastError is the error of the last check, if any.
+	LastError string `json:"last_error,omitempty"`
+
+	// Latency of the check.
+	Latency time.Duration `json:"-"`
+
+	// Name of the check.
+	Name string `json:"name"`
+
+	// Status of the check.
+	Status CheckStatus `json:"status"`
+}
+
+// MarshalJSON adds human, and machine readable latencies.
+func (c CheckResult) MarshalJSON() ([]byte, error) {
+	type alias CheckResult
+
+	return json.Marshal(struct {
+		alias
+
+		Latency        string  `json:"latency"`
+		LatencySeconds float64 `json:"latency_seconds"`
+	}{
+		alias:          alias(c),
+		Latency:        c.Latency.String(),
+		LatencySeconds: c.Latency.Seconds(),
+	})
+}
+
+// Report is the detailed result of all checks.
+type Report struct {
+	// Checks results.
+	Checks []CheckResult `json:"checks"`
+
+	// Status is the final state.
+	Status CheckStatus `json:"status"`
+}
+
+//////
+// Helpers.
+//////
+
+// Concurrently checks all determiners.
+func newReport(ctx context.Context, determiners ...*ReadinessDeterminer) Report {
+	report := Report{
+		Checks: make([]CheckResult, len(determiners)),
+		Status: CheckStatusOK,
+	}
+
+	var wg sync.WaitGroup
+
+	for i, determiner := range determiners {
+		wg.Add(1)
+
+		go func(i int, determiner *ReadinessDeterminer) {
+			defer wg.Done()
+
+			report.Checks[i] = determiner.Check(ctx)
+		}(i, determiner)
+	}
+
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status == CheckStatusOK {
+			continue
+		}
+
+		// If any critical check fails, server fails.
+		if result.Critical {
+			report.Status = CheckStatusFail
+
+			break
+		}
+
+		report.Status = CheckStatusDegraded
+	}
+
+	return report
+}
+
+// Determines if the client asked for the detailed report.
+func wantsVerbose(r *http.Request) bool {
+	return r.URL.Query().Has("verbose") || strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// Replies with `200` status code, and "OK" in the body if ALL critical
+// determiners are ready, otherwise sends `503`, and `format` filled with the
+// failed ones. If the client asks for it, replies with the detailed report.
+func determine(w http.ResponseWriter, r *http.Request, format string, determiners ...*ReadinessDeterminer) {
+	report := newReport(r.Context(), determiners...)
+
+	statusCode := http.StatusOK
+
+	if report.Status == CheckStatusFail {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	if wantsVerbose(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		w.WriteHeader(statusCode)
+
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	if statusCode != http.StatusOK {
+		failedNames := []string{}
+
+		for _, result := range report.Checks {
+			if result.Critical && result.Status != CheckStatusOK {
+				failedNames = append(failedNames, result.Name)
+			}
+		}
+
+		http.Error(w, fmt.Sprintf(format, strings.Join(failedNames, ", ")), statusCode)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	w.WriteHeader(statusCode)
+
+	fmt.Fprintln(w, http.StatusText(statusCode))
+}
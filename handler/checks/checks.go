@@ -0,0 +1,106 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package checks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/thalesfsp/customerror"
+	"github.com/thalesfsp/webserver/handler"
+)
+
+//////
+// Interfaces.
+//////
+
+// Pinger defines what can be pinged, e.g.: `*sql.DB`, `*sql.Conn`.
+type Pinger interface {
+	// PingContext verifies the connection is still alive.
+	PingContext(ctx context.Context) error
+}
+
+//////
+// Checks.
+//////
+
+// TCP checks a TCP connection can be established with `address` (host:port).
+func TCP(address string) handler.CheckFunc {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return customerror.NewFailedToError(fmt.Sprintf("dial %s", address), customerror.WithError(err))
+		}
+
+		return conn.Close()
+	}
+}
+
+// HTTP checks a `GET` to `url` replies with `expectedStatusCode`. Redirects
+// aren't followed.
+func HTTP(url string, expectedStatusCode int) handler.CheckFunc {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return customerror.NewFailedToError("create request", customerror.WithError(err))
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return customerror.NewFailedToError(fmt.Sprintf("get %s", url), customerror.WithError(err))
+		}
+
+		defer resp.Body.Close()
+
+		// Allows the connection to be reused.
+		_, _ = io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode != expectedStatusCode {
+			return customerror.NewInvalidError(
+				fmt.Sprintf("status code, expected %d got %d", expectedStatusCode, resp.StatusCode),
+			)
+		}
+
+		return nil
+	}
+}
+
+// DNS checks `host` resolves to at least one address.
+func DNS(host string) handler.CheckFunc {
+	return func(ctx context.Context) error {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return customerror.NewFailedToError(fmt.Sprintf("lookup %s", host), customerror.WithError(err))
+		}
+
+		if len(addrs) == 0 {
+			return customerror.NewFailedToError(fmt.Sprintf("lookup %s, no address found", host))
+		}
+
+		return nil
+	}
+}
+
+// Ping checks `pinger` is reachable, e.g.: a `*sql.DB`.
+func Ping(pinger Pinger) handler.CheckFunc {
+	return func(ctx context.Context) error {
+		if err := pinger.PingContext(ctx); err != nil {
+			return customerror.NewFailedToError("ping", customerror.WithError(err))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package checks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/thalesfsp/webserver/handler"
+)
+
+// Simulates a database connection.
+type pingerFunc func(ctx context.Context) error
+
+func (p pingerFunc) PingContext(ctx context.Context) error {
+	return p(ctx)
+}
+
+// Returns the address of a listener which is already closed.
+func closedAddress(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := l.Addr().String()
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return address
+}
+
+func TestChecks(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	defer upstream.Close()
+
+	tests := []struct {
+		name    string
+		check   handler.CheckFunc
+		wantErr bool
+	}{
+		{
+			name:  "Should work - TCP",
+			check: TCP(listener.Addr().String()),
+		},
+		{
+			name:    "Should fail - TCP",
+			check:   TCP(closedAddress(t)),
+			wantErr: true,
+		},
+		{
+			name:  "Should work - HTTP",
+			check: HTTP(upstream.URL+"/up", http.StatusOK),
+		},
+		{
+			name:    "Should fail - HTTP - unexpected status code",
+			check:   HTTP(upstream.URL+"/down", http.StatusOK),
+			wantErr: true,
+		},
+		{
+			name:    "Should fail - HTTP - unreachable",
+			check:   HTTP("http://"+closedAddress(t), http.StatusOK),
+			wantErr: true,
+		},
+		{
+			name:  "Should work - DNS",
+			check: DNS("localhost"),
+		},
+		{
+			name:    "Should fail - DNS",
+			check:   DNS("does-not-exist.invalid"),
+			wantErr: true,
+		},
+		{
+			name:  "Should work - Ping",
+			check: Ping(pingerFunc(func(ctx context.Context) error { return nil })),
+		},
+		{
+			name:    "Should fail - Ping",
+			check:   Ping(pingerFunc(func(ctx context.Context) error { return errors.New("bad connection") })),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := tt.check(ctx); (err != nil) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChecks_readiness(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	h := handler.Readiness(
+		handler.NewCheck("redis", TCP(listener.Addr().String()), time.Second, 0, true),
+		handler.NewCheck("postgres", TCP(closedAddress(t)), time.Second, 0, true),
+	)
+
+	w := httptest.NewRecorder()
+
+	h.Handler(w, httptest.NewRequest(http.MethodGet, "/readiness", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expect %v got %v", http.StatusServiceUnavailable, w.Code)
+	}
+}
@@ -0,0 +1,3 @@
+// Package checks provides ready-made dependency checks, e.g.: TCP, HTTP, DNS,
+// and databases, to be used with `handler.NewCheck`.
+package checks
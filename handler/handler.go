@@ -6,10 +6,18 @@ package handler
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/thalesfsp/webserver/internal/validation"
 )
 
+//////
+// Consts, and vars.
+//////
+
+// NoTimeout opts a handler out of the request timeout.
+const NoTimeout time.Duration = -1
+
 //////
 // Definition.
 //////
@@ -24,6 +32,22 @@ type Handler struct {
 
 	// Path to run the `Handler`.
 	Path string `json:"path" validate:"required"`
+
+	// Probe handlers (e.g.: liveness, readiness, and startup) are served
+	// while startup hooks run, other routes reply `503` until they complete,
+	// default: false.
+	Probe bool `json:"probe"`
+
+	// Streaming handlers (e.g.: SSE, chunked, WebSocket) aren't subject to
+	// timeouts: the response isn't buffered, `http.Flusher`, and
+	// `http.Hijacker` work, and the connection deadlines are cleared,
+	// default: false.
+	Streaming bool `json:"streaming"`
+
+	// Timeout max duration of the `Handler`. Once reached, the request context
+	// is canceled, and the client gets the timeout error. Set to `NoTimeout`
+	// to disable it, default: 0 (the server `RequestTimeout`).
+	Timeout time.Duration `json:"timeout"`
 }
 
 //////
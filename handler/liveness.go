@@ -10,10 +10,17 @@ import (
 )
 
 // Liveness indicates the server is up, and running. It follows the "standard"
-// which is send `200` status code, and "OK" in the body.
-func Liveness() Handler {
+// which is send `200` status code, and "OK" in the body. Optionally, checks
+// can be passed, see `Readiness` for their semantics.
+func Liveness(livenessStates ...*ReadinessDeterminer) Handler {
 	return Handler{
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(livenessStates) > 0 {
+				determine(w, r, "server isn't alive. %s failed liveness", livenessStates...)
+
+				return
+			}
+
 			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
 			w.WriteHeader(http.StatusOK)
@@ -22,5 +29,6 @@ func Liveness() Handler {
 		}),
 		Method: http.MethodGet,
 		Path:   "/liveness",
+		Probe:  true,
 	}
 }
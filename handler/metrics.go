@@ -10,11 +10,31 @@ import (
 	"github.com/thalesfsp/webserver/metric"
 )
 
-// Metrics serves metrics.
-func Metrics() Handler {
+// Metrics serves metrics of `registries`. If a name is published in more than
+// one, the first registry wins. If none is passed, the package-level registry
+// is served.
+func Metrics(registries ...*metric.Registry) Handler {
+	if len(registries) == 0 {
+		registries = []*metric.Registry{metric.Default()}
+	}
+
 	return Handler{
-		Handler: metric.Handler().ServeHTTP,
+		Handler: metric.HandlerFor(registries...).ServeHTTP,
 		Method:  http.MethodGet,
 		Path:    "/debug/vars",
 	}
 }
+
+// Prometheus serves metrics of `registries` in the Prometheus text format,
+// see `Metrics`.
+func Prometheus(registries ...*metric.Registry) Handler {
+	if len(registries) == 0 {
+		registries = []*metric.Registry{metric.Default()}
+	}
+
+	return Handler{
+		Handler: metric.PrometheusHandlerFor(registries...).ServeHTTP,
+		Method:  http.MethodGet,
+		Path:    "/metrics",
+	}
+}
@@ -5,17 +5,43 @@
 package handler
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"net/http"
-	"strings"
 	"sync"
+	"time"
+
+	"github.com/thalesfsp/webserver/internal/runner"
 )
 
-// ReadinessDeterminer definition. It determines if `name` is ready.
+// ErrNotReady indicates a passive determiner isn't ready.
+var ErrNotReady = errors.New("not ready")
+
+// ReadinessDeterminer definition. It determines if `name` is ready. It's either
+// passive - someone sets its readiness, or active - a check function
+// determines it.
 type ReadinessDeterminer struct {
 	name  string
 	ready bool
 	m     sync.Mutex
+
+	// Active check, default: none.
+	check CheckFunc
+
+	// Serializes checks, so concurrent probes share cached results.
+	checkMutex sync.Mutex
+
+	// Result caching interval, default: 0 (no caching).
+	interval time.Duration
+
+	// Last check result.
+	lastResult *CheckResult
+
+	// Non-critical determiners don't affect the final state, default: false.
+	optional bool
+
+	// Check timeout, default: 0 (no timeout).
+	timeout time.Duration
 }
 
 // Set state name.
@@ -34,7 +60,8 @@ func (t *ReadinessDeterminer) GetName() string {
 	return t.name
 }
 
-// Set readiness state.
+// Set readiness state. For active determiners, it's combined with the check
+// result - `false` makes it not ready regardless of the check.
 func (t *ReadinessDeterminer) SetReadiness(v bool) {
 	t.m.Lock()
 	defer t.m.Unlock()
@@ -42,12 +69,96 @@ func (t *ReadinessDeterminer) SetReadiness(v bool) {
 	t.ready = v
 }
 
-// Get readiness state.
+// Get readiness state. For active determiners, it runs the check (honoring
+// caching).
 func (t *ReadinessDeterminer) GetReadiness() bool {
+	return t.Check(context.Background()).Status == CheckStatusOK
+}
+
+// IsCritical returns if the determiner affects the final state.
+func (t *ReadinessDeterminer) IsCritical() bool {
 	t.m.Lock()
 	defer t.m.Unlock()
 
-	return t.ready
+	return !t.optional
+}
+
+// Check determines the readiness. For active determiners, it runs the check
+// function within the timeout, unless a result is cached within the caching
+// interval.
+func (t *ReadinessDeterminer) Check(ctx context.Context) CheckResult {
+	t.m.Lock()
+	name, ready, check, critical := t.name, t.ready, t.check, !t.optional
+	t.m.Unlock()
+
+	if check == nil {
+		result := CheckResult{
+			CheckedAt: time.Now(),
+			Critical:  critical,
+			Name:      name,
+			Status:    CheckStatusOK,
+		}
+
+		if !ready {
+			result.Status = CheckStatusFail
+			result.LastError = ErrNotReady.Error()
+		}
+
+		return result
+	}
+
+	result := t.runCheck(ctx, check)
+	result.Name = name
+	result.Critical = critical
+
+	if !ready {
+		result.Status = CheckStatusFail
+		result.LastError = ErrNotReady.Error()
+	}
+
+	return result
+}
+
+// Runs the check function, or returns the cached result.
+func (t *ReadinessDeterminer) runCheck(ctx context.Context, check CheckFunc) CheckResult {
+	t.checkMutex.Lock()
+	defer t.checkMutex.Unlock()
+
+	if t.lastResult != nil && t.interval > 0 && time.Since(t.lastResult.CheckedAt) < t.interval {
+		return *t.lastResult
+	}
+
+	checkCtx := ctx
+
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+
+		checkCtx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	began := time.Now()
+
+	err := runner.Run(checkCtx, check)
+
+	result := &CheckResult{
+		CheckedAt: began,
+		Latency:   time.Since(began),
+		Status:    CheckStatusOK,
+	}
+
+	if err != nil {
+		result.Status = CheckStatusFail
+		result.LastError = err.Error()
+	}
+
+	// A probe cancelled by its client doesn't tell about the dependency, so
+	// it isn't cached.
+	if ctx.Err() == nil {
+		t.lastResult = result
+	}
+
+	return *result
 }
 
 // NewReadinessDeterminer is the Readiness factory.
@@ -59,42 +170,36 @@ func NewReadinessDeterminer(name string) *ReadinessDeterminer {
 	}
 }
 
+// NewCheck is the active Readiness factory. `check` determines the readiness,
+// it runs within `timeout`, and its result is cached for `interval` - set
+// both to `0` to disable them. Non-`critical` failing checks are reported,
+// but don't affect the final state.
+func NewCheck(name string, check CheckFunc, timeout, interval time.Duration, critical bool) *ReadinessDeterminer {
+	return &ReadinessDeterminer{
+		name:     name,
+		ready:    true,
+		m:        sync.Mutex{},
+		check:    check,
+		interval: interval,
+		optional: !critical,
+		timeout:  timeout,
+	}
+}
+
 // Readiness indicates the server is up, running, and ready to work. It follows
 // the "standard" which is send `200` status code, and "OK" in the body if it's
 // ready, otherwise sends `503`, "Service Unavailable", and the error. Multiple
-// readinesses determiners can be passed. In this case, only if ALL are ready,
-// the server will be considered ready.
+// readinesses determiners can be passed. In this case, only if ALL critical
+// ones are ready, the server will be considered ready. A JSON document
+// detailing each determiner is sent if the `verbose` query param is set, or
+// the client accepts `application/json`.
 func Readiness(readinessStates ...*ReadinessDeterminer) Handler {
 	return Handler{
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			readinessStateFinalState := true
-			readinessesNames := []string{}
-
-			for _, readinessState := range readinessStates {
-				// If any state isn't ready, server isn't ready.
-				if !readinessState.GetReadiness() {
-					readinessStateFinalState = false
-					readinessesNames = append(readinessesNames, readinessState.GetName())
-				}
-			}
-
-			if !readinessStateFinalState {
-				http.Error(
-					w,
-					fmt.Sprintf("server isn't ready. %s failed readiness", strings.Join(readinessesNames, ", ")),
-					http.StatusServiceUnavailable,
-				)
-
-				return
-			}
-
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-
-			w.WriteHeader(http.StatusOK)
-
-			fmt.Fprintln(w, http.StatusText(http.StatusOK))
+			determine(w, r, "server isn't ready. %s failed readiness", readinessStates...)
 		}),
 		Method: http.MethodGet,
 		Path:   "/readiness",
+		Probe:  true,
 	}
 }
@@ -0,0 +1,164 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadiness_checks(t *testing.T) {
+	var calls int64
+
+	cached := NewCheck("cache", func(ctx context.Context) error {
+		atomic.AddInt64(&calls, 1)
+
+		return nil
+	}, time.Second, time.Minute, true)
+
+	slow := NewCheck("upstream", func(ctx context.Context) error {
+		<-ctx.Done()
+
+		return ctx.Err()
+	}, 50*time.Millisecond, 0, false)
+
+	broken := NewCheck("db", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}, time.Second, 0, true)
+
+	type args struct {
+		determiners []*ReadinessDeterminer
+		target      string
+		accept      string
+	}
+	tests := []struct {
+		name         string
+		args         args
+		wantSC       int
+		wantBody     string
+		wantStatuses map[string]CheckStatus
+	}{
+		{
+			name: "Should work - non-critical failure is degraded",
+			args: args{
+				determiners: []*ReadinessDeterminer{cached, slow},
+				target:      "/readiness",
+			},
+			wantSC:   http.StatusOK,
+			wantBody: http.StatusText(http.StatusOK),
+		},
+		{
+			name: "Should work - critical failure",
+			args: args{
+				determiners: []*ReadinessDeterminer{cached, broken},
+				target:      "/readiness",
+			},
+			wantSC:   http.StatusServiceUnavailable,
+			wantBody: "db failed readiness",
+		},
+		{
+			name: "Should work - verbose",
+			args: args{
+				determiners: []*ReadinessDeterminer{cached, slow, broken},
+				target:      "/readiness?verbose",
+			},
+			wantSC:   http.StatusServiceUnavailable,
+			wantBody: `"status":"fail"`,
+			wantStatuses: map[string]CheckStatus{
+				"cache":    CheckStatusOK,
+				"upstream": CheckStatusFail,
+				"db":       CheckStatusFail,
+			},
+		},
+		{
+			name: "Should work - JSON",
+			args: args{
+				determiners: []*ReadinessDeterminer{cached, slow},
+				target:      "/readiness",
+				accept:      "application/json",
+			},
+			wantSC:   http.StatusOK,
+			wantBody: `"status":"degraded"`,
+			wantStatuses: map[string]CheckStatus{
+				"cache":    CheckStatusOK,
+				"upstream": CheckStatusFail,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.args.target, nil)
+			r.Header.Set("Accept", tt.args.accept)
+
+			w := httptest.NewRecorder()
+
+			Readiness(tt.args.determiners...).Handler(w, r)
+
+			if w.Code != tt.wantSC {
+				t.Fatalf("Expect %v got %v", tt.wantSC, w.Code)
+			}
+
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Fatalf("Expect %v got %v", tt.wantBody, w.Body.String())
+			}
+
+			if tt.wantStatuses == nil {
+				return
+			}
+
+			report := Report{}
+
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, result := range report.Checks {
+				if result.Status != tt.wantStatuses[result.Name] {
+					t.Fatalf("Expect %s to be %v got %v", result.Name, tt.wantStatuses[result.Name], result.Status)
+				}
+			}
+		})
+	}
+
+	// Results are cached within the interval.
+	if got := atomic.LoadInt64(&calls); got != 1 {
+		t.Fatalf("Expect %v got %v", 1, got)
+	}
+}
+
+func TestReadiness_cancelledProbe(t *testing.T) {
+	check := NewCheck("cache", func(ctx context.Context) error {
+		return ctx.Err()
+	}, time.Second, time.Minute, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if got := check.Check(ctx).Status; got != CheckStatusFail {
+		t.Fatalf("Expect %v got %v", CheckStatusFail, got)
+	}
+
+	// A cancelled probe isn't cached.
+	if got := check.Check(context.Background()).Status; got != CheckStatusOK {
+		t.Fatalf("Expect %v got %v", CheckStatusOK, got)
+	}
+}
+
+func TestReadiness_panickingCheck(t *testing.T) {
+	check := NewCheck("cache", func(ctx context.Context) error {
+		panic("boom")
+	}, time.Second, 0, true)
+
+	if got := check.Check(context.Background()); got.Status != CheckStatusFail || !strings.Contains(got.LastError, "boom") {
+		t.Fatalf("Expect a failure with the panic got %+v", got)
+	}
+}
@@ -0,0 +1,438 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//////
+// Consts, and vars.
+//////
+
+// DropPolicy determines what happens when a client buffer is full.
+type DropPolicy string
+
+const (
+	// DropOldest discards the oldest buffered event.
+	DropOldest DropPolicy = "oldest"
+
+	// DropNewest discards the incoming event.
+	DropNewest DropPolicy = "newest"
+
+	// Disconnect closes the slow client connection.
+	Disconnect DropPolicy = "disconnect"
+)
+
+// Strips line breaks, so values can't inject fields.
+var lineBreakStripper = strings.NewReplacer("\r\n", "", "\r", "", "\n", "")
+
+// Splits data in lines, as clients do.
+var lineBreakNormalizer = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+const (
+	defaultSSEBufferSize = 64
+	defaultSSEHeartbeat  = 15 * time.Second
+	lastEventIDHeader    = "Last-Event-ID"
+	lastEventIDParam     = "lastEventId"
+)
+
+//////
+// Definitions.
+//////
+
+// Event is a server-sent event.
+type Event struct {
+	// Data of the event. Multi-line data is split in multiple `data` fields.
+	Data string `json:"data"`
+
+	// Event type, default: "message". Line breaks are stripped.
+	Event string `json:"event,omitempty"`
+
+	// ID of the event. Clients resume from it after reconnecting. Line breaks
+	// are stripped.
+	ID string `json:"id,omitempty"`
+
+	// Retry tells clients how long to wait before reconnecting.
+	Retry time.Duration `json:"retry,omitempty"`
+}
+
+// WriteTo writes the event in the `text/event-stream` format.
+func (e Event) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	if id := lineBreakStripper.Replace(e.ID); id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+
+	if event := lineBreakStripper.Replace(e.Event); event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry.Milliseconds())
+	}
+
+	for _, line := range strings.Split(lineBreakNormalizer.Replace(e.Data), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+
+	b.WriteString("\n")
+
+	n, err := io.WriteString(w, b.String())
+
+	return int64(n), err
+}
+
+// SubscribeFunc subscribes a client to an event source. `lastEventID` is the
+// last event the client got, if it's resuming. The channel should be closed
+// once `ctx` is done, or there are no more events.
+type SubscribeFunc func(ctx context.Context, lastEventID string) (<-chan Event, error)
+
+// SSEOption allows to specify options.
+type SSEOption func(c *sseConfig)
+
+// SSE settings.
+type sseConfig struct {
+	bufferSize int
+	heartbeat  time.Duration
+	policy     DropPolicy
+	retry      time.Duration
+}
+
+// WithSSEBuffer sets how many events are buffered per client, and what happens
+// when the buffer is full, default: 64, and `DropOldest`.
+func WithSSEBuffer(size int, policy DropPolicy) SSEOption {
+	return func(c *sseConfig) {
+		c.bufferSize = size
+		c.policy = policy
+	}
+}
+
+// WithSSEHeartbeat sets the interval of the comments sent to keep idle
+// connections open. Set to `0` to disable it, default: 15s.
+func WithSSEHeartbeat(interval time.Duration) SSEOption {
+	return func(c *sseConfig) {
+		c.heartbeat = interval
+	}
+}
+
+// WithSSERetry sets the reconnection delay sent to clients when they connect.
+func WithSSERetry(retry time.Duration) SSEOption {
+	return func(c *sseConfig) {
+		c.retry = retry
+	}
+}
+
+//////
+// Event broker.
+//////
+
+// EventBroker fans out published events to all subscribers, keeping the last
+// ones, so resuming clients get what they missed.
+type EventBroker struct {
+	history     []Event
+	historySize int
+	m           sync.Mutex
+	seq         uint64
+	subscribers map[*subscriber]struct{}
+}
+
+// EventBroker subscriber.
+type subscriber struct {
+	events chan Event
+}
+
+// Publish sends `event` to all subscribers, without blocking. Events without
+// ID get a sequential one. Each subscriber buffers up to 64 events, the oldest
+// is dropped when it's full.
+func (b *EventBroker) Publish(event Event) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.seq++
+
+	if event.ID == "" {
+		event.ID = strconv.FormatUint(b.seq, 10)
+	}
+
+	if b.historySize > 0 {
+		if len(b.history) >= b.historySize {
+			b.history = b.history[1:]
+		}
+
+		b.history = append(b.history, event)
+	}
+
+	// Only `Publish`, and `Subscribe` send, under the lock, so there's room
+	// after dropping the oldest.
+	for sub := range b.subscribers {
+		select {
+		case sub.events <- event:
+			continue
+		default:
+		}
+
+		select {
+		case <-sub.events:
+		default:
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
+
+// Forward publishes every event from `events` until it's closed.
+func (b *EventBroker) Forward(events <-chan Event) {
+	for event := range events {
+		b.Publish(event)
+	}
+}
+
+// Subscribe satisfies `SubscribeFunc`. Events published after `lastEventID`
+// are replayed, if they are still in the history.
+func (b *EventBroker) Subscribe(ctx context.Context, lastEventID string) (<-chan Event, error) {
+	b.m.Lock()
+
+	missed := []Event{}
+
+	if lastEventID != "" {
+		for i, event := range b.history {
+			if event.ID == lastEventID {
+				missed = append(missed, b.history[i+1:]...)
+
+				break
+			}
+		}
+	}
+
+	bufferSize := defaultSSEBufferSize
+
+	if len(missed) > bufferSize {
+		bufferSize = len(missed)
+	}
+
+	sub := &subscriber{
+		events: make(chan Event, bufferSize),
+	}
+
+	for _, event := range missed {
+		sub.events <- event
+	}
+
+	b.subscribers[sub] = struct{}{}
+
+	b.m.Unlock()
+
+	out := make(chan Event)
+
+	go func() {
+		defer close(out)
+
+		defer func() {
+			b.m.Lock()
+			delete(b.subscribers, sub)
+			b.m.Unlock()
+		}()
+
+		for {
+			select {
+			case event := <-sub.events:
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// Len returns the number of subscribers.
+func (b *EventBroker) Len() int {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return len(b.subscribers)
+}
+
+// NewEventBroker is the `EventBroker` factory. The last `historySize` events
+// are kept for resuming clients.
+func NewEventBroker(historySize int) *EventBroker {
+	return &EventBroker{
+		historySize: historySize,
+		subscribers: map[*subscriber]struct{}{},
+	}
+}
+
+//////
+// Helpers.
+//////
+
+// Buffers events from `events`, applying `policy` when `buffer` is full. It
+// closes `buffer` once `events` is closed, or `ctx` is done. Returns `false`
+// if the client should be disconnected.
+func bufferEvents(ctx context.Context, events <-chan Event, buffer chan Event, policy DropPolicy) bool {
+	defer close(buffer)
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return true
+			}
+
+			select {
+			case buffer <- event:
+				continue
+			default:
+			}
+
+			switch policy {
+			case DropNewest:
+			case Disconnect:
+				return false
+			default:
+				// Only this goroutine sends, so there's room after dropping
+				// the oldest.
+				select {
+				case <-buffer:
+				default:
+				}
+
+				buffer <- event
+			}
+		case <-ctx.Done():
+			return true
+		}
+	}
+}
+
+// Gets the last event ID from the header, or from the query - for clients
+// which can't set headers.
+func lastEventID(r *http.Request) string {
+	if id := r.Header.Get(lastEventIDHeader); id != "" {
+		return id
+	}
+
+	return r.URL.Query().Get(lastEventIDParam)
+}
+
+//////
+// Factory.
+//////
+
+// SSE streams server-sent events from `subscribe` to each client. Resuming
+// clients send the last event ID they got (`Last-Event-ID` header, or
+// `lastEventId` query param). Idle connections are kept open with heartbeat
+// comments. Events are buffered per client, so slow clients don't block the
+// source, see `WithSSEBuffer`. The stream ends when the client disconnects,
+// the source channel is closed, or the server starts draining.
+func SSE(path string, subscribe SubscribeFunc, opts ...SSEOption) Handler {
+	cfg := &sseConfig{
+		bufferSize: defaultSSEBufferSize,
+		heartbeat:  defaultSSEHeartbeat,
+		policy:     DropOldest,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.bufferSize < 1 {
+		cfg.bufferSize = 1
+	}
+
+	return Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+
+				return
+			}
+
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+
+			events, err := subscribe(ctx, lastEventID(r))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+
+				return
+			}
+
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("X-Accel-Buffering", "no")
+
+			w.WriteHeader(http.StatusOK)
+
+			if cfg.retry > 0 {
+				fmt.Fprintf(w, "retry: %d\n\n", cfg.retry.Milliseconds())
+			}
+
+			flusher.Flush()
+
+			buffer := make(chan Event, cfg.bufferSize)
+
+			go func() {
+				if !bufferEvents(ctx, events, buffer, cfg.policy) {
+					cancel()
+				}
+			}()
+
+			var heartbeat <-chan time.Time
+
+			if cfg.heartbeat > 0 {
+				ticker := time.NewTicker(cfg.heartbeat)
+				defer ticker.Stop()
+
+				heartbeat = ticker.C
+			}
+
+			for {
+				select {
+				case event, ok := <-buffer:
+					if !ok {
+						return
+					}
+
+					if _, err := event.WriteTo(w); err != nil {
+						return
+					}
+
+					flusher.Flush()
+				case <-heartbeat:
+					if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+						return
+					}
+
+					flusher.Flush()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}),
+		Method:    http.MethodGet,
+		Path:      path,
+		Streaming: true,
+	}
+}
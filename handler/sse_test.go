@@ -0,0 +1,224 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Reads `n` SSE frames (events, or comments) from `r`.
+func readFrames(t *testing.T, r *bufio.Reader, n int) []string {
+	t.Helper()
+
+	frames := []string{}
+	frame := ""
+
+	for len(frames) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line == "\n" {
+			frames = append(frames, frame)
+			frame = ""
+
+			continue
+		}
+
+		frame += line
+	}
+
+	return frames
+}
+
+func TestSSE(t *testing.T) {
+	broker := NewEventBroker(10)
+
+	h := SSE("/events", broker.Subscribe, WithSSEHeartbeat(50*time.Millisecond), WithSSERetry(time.Second))
+
+	if !h.Streaming {
+		t.Fatal("Expected a streaming handler")
+	}
+
+	ts := httptest.NewServer(h.Handler)
+	defer ts.Close()
+
+	broker.Publish(Event{Data: "first"})
+	broker.Publish(Event{Data: "second\nline", Event: "job"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Resumes after the first event.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"?lastEventId=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected content type %q, got %q", "text/event-stream", ct)
+	}
+
+	r := bufio.NewReader(resp.Body)
+
+	got := readFrames(t, r, 2)
+
+	want := []string{
+		"retry: 1000\n",
+		"id: 2\nevent: job\ndata: second\ndata: line\n",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %q, got %q", want, got)
+	}
+
+	// Idle, so a heartbeat comes next.
+	if got := readFrames(t, r, 1); got[0] != ": heartbeat\n" {
+		t.Fatalf("Expected heartbeat, got %q", got[0])
+	}
+
+	broker.Publish(Event{Data: "third"})
+
+	for {
+		frame := readFrames(t, r, 1)[0]
+
+		if strings.HasPrefix(frame, ":") {
+			continue
+		}
+
+		if frame != "id: 3\ndata: third\n" {
+			t.Fatalf("Expected third event, got %q", frame)
+		}
+
+		break
+	}
+
+	// Client disconnects, so it's unsubscribed.
+	cancel()
+
+	deadline := time.Now().Add(2 * time.Second)
+
+	for broker.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected subscriber to be removed")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_bufferEvents(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     DropPolicy
+		want       []string
+		wantResult bool
+	}{
+		{
+			name:       "Should work - drop oldest",
+			policy:     DropOldest,
+			want:       []string{"2", "3"},
+			wantResult: true,
+		},
+		{
+			name:       "Should work - drop newest",
+			policy:     DropNewest,
+			want:       []string{"1", "2"},
+			wantResult: true,
+		},
+		{
+			name:       "Should work - disconnect",
+			policy:     Disconnect,
+			want:       []string{"1", "2"},
+			wantResult: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make(chan Event, 3)
+
+			for _, id := range []string{"1", "2", "3"} {
+				events <- Event{ID: id}
+			}
+
+			close(events)
+
+			buffer := make(chan Event, 2)
+
+			if got := bufferEvents(context.Background(), events, buffer, tt.policy); got != tt.wantResult {
+				t.Fatalf("bufferEvents() = %v, want %v", got, tt.wantResult)
+			}
+
+			got := []string{}
+
+			for event := range buffer {
+				got = append(got, event.ID)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("bufferEvents() buffered %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventBroker_Publish_slowSubscriber(t *testing.T) {
+	broker := NewEventBroker(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Never drained.
+	if _, err := broker.Subscribe(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	published := make(chan struct{})
+
+	go func() {
+		defer close(published)
+
+		for i := 0; i < defaultSSEBufferSize*2; i++ {
+			broker.Publish(Event{Data: "event"})
+		}
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Expected publishing not to block on a slow subscriber")
+	}
+}
+
+func TestEvent_WriteTo(t *testing.T) {
+	var b strings.Builder
+
+	event := Event{ID: "1\ndata: injected", Event: "job\r\nid: 2", Data: "a\rb"}
+
+	if _, err := event.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "id: 1data: injected\nevent: jobid: 2\ndata: a\ndata: b\n\n"
+
+	if b.String() != want {
+		t.Fatalf("Expect %q got %q", want, b.String())
+	}
+}
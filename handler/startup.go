@@ -0,0 +1,24 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"net/http"
+)
+
+// Startup indicates the server finished starting up, e.g.: all startup hooks
+// completed. It follows the Kubernetes `startupProbe` semantics: sends `503`,
+// and the error until ALL determiners are ready, then `200` status code, and
+// "OK" in the body.
+func Startup(startupStates ...*ReadinessDeterminer) Handler {
+	return Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			determine(w, r, "server is starting. %s pending", startupStates...)
+		}),
+		Method: http.MethodGet,
+		Path:   "/startup",
+		Probe:  true,
+	}
+}
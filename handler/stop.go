@@ -5,40 +5,66 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-	"os"
 )
 
-// Stop allows the server to be remotely, and gracefully stopped. Optionally set
-// the `hard` query param to `true` to immediately kill the server.
-func Stop() Handler {
-	return Handler{
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			queryParams := r.URL.Query()
+//////
+// Consts, and vars.
+//////
 
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+// Context key type, avoids collisions with keys from other packages.
+type stopContextKey struct{}
 
-			w.WriteHeader(http.StatusOK)
+//////
+// Definitions.
+//////
 
-			fmt.Fprintln(w, http.StatusText(http.StatusOK))
+// StopFunc stops the server serving the request, without waiting for it.
+// `hard` skips draining in-flight requests.
+type StopFunc func(hard bool) error
 
-			sig := os.Interrupt
+//////
+// Helpers.
+//////
 
-			if queryParams.Get("hard") == "true" {
-				sig = os.Kill
-			}
+// ContextWithStop stores `stop` in `ctx`. The server stores its own, so the
+// `Stop` handler stops it, and only it.
+func ContextWithStop(ctx context.Context, stop StopFunc) context.Context {
+	return context.WithValue(ctx, stopContextKey{}, stop)
+}
 
-			p, err := os.FindProcess(os.Getpid())
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+//////
+// Factory.
+//////
+
+// Stop allows the server to be remotely, and gracefully stopped. Optionally set
+// the `hard` query param to `true` to immediately stop the server.
+//
+// NOTE: The shutdown goes through the server lifecycle, as `Server.Stop`. No
+// OS signal is sent, other servers in the same process are unaffected.
+func Stop() Handler {
+	return Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			stop, ok := r.Context().Value(stopContextKey{}).(StopFunc)
+			if !ok {
+				http.Error(w, "stop isn't supported by this server", http.StatusNotImplemented)
 
 				return
 			}
 
-			if err := p.Signal(sig); err != nil {
+			if err := stop(r.URL.Query().Get("hard") == "true"); err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
+
+				return
 			}
+
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+			w.WriteHeader(http.StatusOK)
+
+			fmt.Fprintln(w, http.StatusText(http.StatusOK))
 		}),
 		Method: http.MethodGet,
 		Path:   "/stop",
@@ -0,0 +1,523 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//////
+// Consts, and vars.
+//////
+
+const (
+	// TextMessage denotes a text data message.
+	TextMessage = websocket.TextMessage
+
+	// BinaryMessage denotes a binary data message.
+	BinaryMessage = websocket.BinaryMessage
+)
+
+const (
+	defaultWebSocketPongWait   = 60 * time.Second
+	defaultWebSocketReadLimit  = 32 << 10
+	defaultWebSocketSendBuffer = 64
+	defaultWebSocketWriteWait  = 10 * time.Second
+)
+
+var (
+	// ErrConnClosed indicates the connection is closed.
+	ErrConnClosed = errors.New("websocket connection closed")
+
+	// ErrHubClosed indicates the hub is closed, not accepting connections.
+	ErrHubClosed = errors.New("websocket hub closed")
+
+	// ErrSendBufferFull indicates the client isn't keeping up.
+	ErrSendBufferFull = errors.New("websocket send buffer full")
+)
+
+//////
+// Definitions.
+//////
+
+// MessageFunc handles messages sent by clients.
+type MessageFunc func(conn *WebSocketConn, messageType int, data []byte)
+
+// WebSocketOption allows to specify options.
+type WebSocketOption func(c *webSocketConfig)
+
+// WebSocket settings.
+type webSocketConfig struct {
+	onConnect  func(conn *WebSocketConn)
+	pongWait   time.Duration
+	readLimit  int64
+	sendBuffer int
+	upgrader   *websocket.Upgrader
+	writeWait  time.Duration
+}
+
+// WithWebSocketOnConnect sets a function called once a client connects, e.g.:
+// to join rooms.
+func WithWebSocketOnConnect(fn func(conn *WebSocketConn)) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.onConnect = fn
+	}
+}
+
+// WithWebSocketPongWait sets for how long to wait for a pong. Pings are sent
+// at 90% of it, default: 60s.
+func WithWebSocketPongWait(wait time.Duration) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.pongWait = wait
+	}
+}
+
+// WithWebSocketReadLimit sets the max size in bytes of client messages.
+// Clients exceeding it are disconnected, default: 32KiB.
+func WithWebSocketReadLimit(limit int64) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.readLimit = limit
+	}
+}
+
+// WithWebSocketSendBuffer sets how many messages are buffered per client.
+// Clients with a full buffer are disconnected, default: 64.
+func WithWebSocketSendBuffer(size int) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.sendBuffer = size
+	}
+}
+
+// WithWebSocketUpgrader sets the upgrader, e.g.: to check origins.
+func WithWebSocketUpgrader(upgrader *websocket.Upgrader) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.upgrader = upgrader
+	}
+}
+
+// WithWebSocketWriteWait sets the max duration of writes, default: 10s.
+func WithWebSocketWriteWait(wait time.Duration) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.writeWait = wait
+	}
+}
+
+//////
+// Connection.
+//////
+
+// Message to be sent.
+type message struct {
+	data        []byte
+	messageType int
+}
+
+// WebSocketConn is a client connection registered in a `Hub`. It's safe for
+// concurrent use.
+type WebSocketConn struct {
+	closeCode int
+	closeOnce sync.Once
+	closeText string
+	closing   chan struct{}
+	conn      *websocket.Conn
+	done      chan struct{}
+	hub       *Hub
+	request   *http.Request
+	send      chan message
+	writeWait time.Duration
+}
+
+// Request returns the upgraded request.
+func (c *WebSocketConn) Request() *http.Request {
+	return c.request
+}
+
+// Send queues a message to the client.
+func (c *WebSocketConn) Send(messageType int, data []byte) error {
+	select {
+	case <-c.closing:
+		return ErrConnClosed
+	default:
+	}
+
+	select {
+	case c.send <- message{data: data, messageType: messageType}:
+		return nil
+	case <-c.closing:
+		return ErrConnClosed
+	default:
+		c.Close(websocket.CloseTryAgainLater, ErrSendBufferFull.Error())
+
+		return ErrSendBufferFull
+	}
+}
+
+// Join adds the connection to `room`.
+func (c *WebSocketConn) Join(room string) {
+	c.hub.join(c, room)
+}
+
+// Leave removes the connection from `room`.
+func (c *WebSocketConn) Leave(room string) {
+	c.hub.leave(c, room)
+}
+
+// Close sends a close frame with `code`, and `text` to the client, after
+// queued messages, within the write wait. The connection is closed once the
+// client replies, or the read deadline is reached.
+func (c *WebSocketConn) Close(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+
+		close(c.closing)
+	})
+}
+
+// Writes queued messages, then the close frame, within the write wait.
+func (c *WebSocketConn) drain() {
+	deadline := time.Now().Add(c.writeWait)
+
+	_ = c.conn.SetWriteDeadline(deadline)
+
+	// `Send` doesn't queue once closing, so it ends.
+	for queued := true; queued; {
+		select {
+		case msg := <-c.send:
+			if err := c.conn.WriteMessage(msg.messageType, msg.data); err != nil {
+				_ = c.conn.Close()
+
+				return
+			}
+		default:
+			queued = false
+		}
+	}
+
+	_ = c.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(c.closeCode, c.closeText),
+		deadline,
+	)
+}
+
+// Writes queued messages, and pings - the only writer of the connection.
+func (c *WebSocketConn) writePump(pingInterval time.Duration) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeWait))
+
+			if err := c.conn.WriteMessage(msg.messageType, msg.data); err != nil {
+				_ = c.conn.Close()
+
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.writeWait)); err != nil {
+				_ = c.conn.Close()
+
+				return
+			}
+		case <-c.closing:
+			c.drain()
+
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Reads messages until the connection is closed, or the peer stops replying
+// to pings.
+func (c *WebSocketConn) readPump(cfg *webSocketConfig, onMessage MessageFunc) {
+	c.conn.SetReadLimit(cfg.readLimit)
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(cfg.pongWait))
+
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(cfg.pongWait))
+	})
+
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if onMessage != nil {
+			onMessage(c, messageType, data)
+		}
+	}
+}
+
+//////
+// Hub.
+//////
+
+// Hub tracks open WebSocket connections, allowing to broadcast messages to
+// all of them, or to rooms.
+type Hub struct {
+	closed bool
+	conns  map[*WebSocketConn]struct{}
+
+	// Closed once the hub is closed, and all connections finished. Reset by
+	// `Open`, so a stale `Close` doesn't wait on the next generation.
+	drained chan struct{}
+
+	m     sync.Mutex
+	rooms map[string]map[*WebSocketConn]struct{}
+}
+
+// Broadcast sends a message to all connections.
+func (h *Hub) Broadcast(messageType int, data []byte) {
+	for _, conn := range h.snapshot("") {
+		_ = conn.Send(messageType, data)
+	}
+}
+
+// BroadcastTo sends a message to all connections in `room`.
+func (h *Hub) BroadcastTo(room string, messageType int, data []byte) {
+	for _, conn := range h.snapshot(room) {
+		_ = conn.Send(messageType, data)
+	}
+}
+
+// Len returns the number of open connections.
+func (h *Hub) Len() int {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return len(h.conns)
+}
+
+// Open accepts connections again after `Close`, e.g.: when a server is
+// restarted. Hubs are open when created.
+func (h *Hub) Open() {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.closed = false
+	h.drained = nil
+}
+
+// Close stops accepting connections, sends a "going away" close frame to all
+// of them, and waits for them to finish. Once `ctx` is done, remaining ones
+// are closed hard.
+func (h *Hub) Close(ctx context.Context) error {
+	h.m.Lock()
+
+	h.closed = true
+
+	if h.drained == nil {
+		h.drained = make(chan struct{})
+
+		h.closeDrainedLocked()
+	}
+
+	drained := h.drained
+
+	h.m.Unlock()
+
+	conns := h.snapshot("")
+
+	for _, conn := range conns {
+		conn.Close(websocket.CloseGoingAway, "server shutting down")
+	}
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		for _, conn := range h.snapshot("") {
+			_ = conn.conn.Close()
+		}
+
+		return ctx.Err()
+	}
+}
+
+// Copies the connections of `room`, or all of them if it's empty.
+func (h *Hub) snapshot(room string) []*WebSocketConn {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	source := h.conns
+
+	if room != "" {
+		source = h.rooms[room]
+	}
+
+	conns := make([]*WebSocketConn, 0, len(source))
+
+	for conn := range source {
+		conns = append(conns, conn)
+	}
+
+	return conns
+}
+
+func (h *Hub) register(conn *WebSocketConn) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.closed {
+		return ErrHubClosed
+	}
+
+	h.conns[conn] = struct{}{}
+
+	return nil
+}
+
+func (h *Hub) unregister(conn *WebSocketConn) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if _, ok := h.conns[conn]; !ok {
+		return
+	}
+
+	delete(h.conns, conn)
+
+	for room, conns := range h.rooms {
+		delete(conns, conn)
+
+		if len(conns) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+
+	h.closeDrainedLocked()
+}
+
+// Closes `drained` if the hub is closed, and all connections finished.
+func (h *Hub) closeDrainedLocked() {
+	if h.drained == nil || len(h.conns) > 0 {
+		return
+	}
+
+	select {
+	case <-h.drained:
+	default:
+		close(h.drained)
+	}
+}
+
+func (h *Hub) join(conn *WebSocketConn, room string) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if _, ok := h.conns[conn]; !ok {
+		return
+	}
+
+	if h.rooms[room] == nil {
+		h.rooms[room] = map[*WebSocketConn]struct{}{}
+	}
+
+	h.rooms[room][conn] = struct{}{}
+}
+
+func (h *Hub) leave(conn *WebSocketConn, room string) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	delete(h.rooms[room], conn)
+
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+// NewHub is the `Hub` factory.
+func NewHub() *Hub {
+	return &Hub{
+		conns: map[*WebSocketConn]struct{}{},
+		rooms: map[string]map[*WebSocketConn]struct{}{},
+	}
+}
+
+//////
+// Factory.
+//////
+
+// WebSocket upgrades requests to WebSocket connections registered in `hub`.
+// Client messages are handled by `onMessage`. Connections are kept alive with
+// pings, and closed if clients don't reply, send messages bigger than the read
+// limit, or don't keep up with sent messages.
+func WebSocket(path string, hub *Hub, onMessage MessageFunc, opts ...WebSocketOption) Handler {
+	cfg := &webSocketConfig{
+		pongWait:   defaultWebSocketPongWait,
+		readLimit:  defaultWebSocketReadLimit,
+		sendBuffer: defaultWebSocketSendBuffer,
+		upgrader:   &websocket.Upgrader{},
+		writeWait:  defaultWebSocketWriteWait,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.sendBuffer < 1 {
+		cfg.sendBuffer = 1
+	}
+
+	return Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// On failure, the upgrader replies with the error.
+			ws, err := cfg.upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+
+			defer ws.Close()
+
+			conn := &WebSocketConn{
+				closing:   make(chan struct{}),
+				conn:      ws,
+				done:      make(chan struct{}),
+				hub:       hub,
+				request:   r,
+				send:      make(chan message, cfg.sendBuffer),
+				writeWait: cfg.writeWait,
+			}
+
+			if err := hub.register(conn); err != nil {
+				_ = ws.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, err.Error()),
+					time.Now().Add(cfg.writeWait),
+				)
+
+				return
+			}
+
+			defer hub.unregister(conn)
+			defer close(conn.done)
+
+			go conn.writePump(cfg.pongWait * 9 / 10)
+
+			if cfg.onConnect != nil {
+				cfg.onConnect(conn)
+			}
+
+			conn.readPump(cfg, onMessage)
+		}),
+		Method:    http.MethodGet,
+		Path:      path,
+		Streaming: true,
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocket_readLimit(t *testing.T) {
+	hub := NewHub()
+
+	h := WebSocket("/ws", hub, nil, WithWebSocketReadLimit(8))
+
+	if !h.Streaming {
+		t.Fatal("Expected a streaming handler")
+	}
+
+	ts := httptest.NewServer(h.Handler)
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("way over the limit")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = conn.ReadMessage()
+
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseMessageTooBig {
+		t.Fatalf("Expected close code %d, got %v", websocket.CloseMessageTooBig, err)
+	}
+
+	// Closed hubs don't accept connections.
+	if err := hub.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, _, err = websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	_, _, err = conn.ReadMessage()
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Fatalf("Expected close code %d, got %v", websocket.CloseGoingAway, err)
+	}
+}
+
+func TestWebSocket_closeDrains(t *testing.T) {
+	hub := NewHub()
+
+	h := WebSocket("/ws", hub, nil, WithWebSocketOnConnect(func(conn *WebSocketConn) {
+		for _, msg := range []string{"first", "second", "third"} {
+			if err := conn.Send(TextMessage, []byte(msg)); err != nil {
+				t.Error(err)
+			}
+		}
+
+		conn.Close(websocket.CloseNormalClosure, "bye")
+	}))
+
+	ts := httptest.NewServer(h.Handler)
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queued messages are sent before the close frame.
+	for _, want := range []string{"first", "second", "third"} {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != want {
+			t.Fatalf("Expected message %q, got %q", want, data)
+		}
+	}
+
+	_, _, err = conn.ReadMessage()
+
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseNormalClosure {
+		t.Fatalf("Expected close code %d, got %v", websocket.CloseNormalClosure, err)
+	}
+}
+
+func TestHub_reopen(t *testing.T) {
+	hub := NewHub()
+
+	ts := httptest.NewServer(WebSocket("/ws", hub, nil).Handler)
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	waitLen := func(n int) {
+		t.Helper()
+
+		for deadline := time.Now().Add(5 * time.Second); hub.Len() != n; {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d connections, got %d", n, hub.Len())
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Doesn't read, so it never acknowledges the close frame.
+	stuck, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer stuck.Close()
+
+	waitLen(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := hub.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	waitLen(0)
+
+	// The next generation is waited on its own.
+	hub.Open()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	waitLen(1)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := hub.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := hub.Len(); n != 0 {
+		t.Fatalf("Expected no connections, got %d", n)
+	}
+}
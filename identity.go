@@ -0,0 +1,23 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package webserver
+
+import (
+	"context"
+
+	"github.com/thalesfsp/webserver/internal/middleware"
+)
+
+// ClientIdentity is the verified identity of a client which authenticated with
+// a certificate (mTLS).
+type ClientIdentity = middleware.Identity
+
+// ClientIdentityFromContext returns the verified client identity from the
+// request context. It's only available if client certificates are required.
+//
+// SEE: `WithClientCA`.
+func ClientIdentityFromContext(ctx context.Context) (*ClientIdentity, bool) {
+	return middleware.IdentityFromContext(ctx)
+}
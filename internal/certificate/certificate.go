@@ -0,0 +1,132 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package certificate
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Definition.
+//////
+
+// Reloader holds a key pair, reloading it whenever the certificate, or the key
+// file changes.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	m           sync.RWMutex
+}
+
+//////
+// Helpers.
+//////
+
+// Returns the modification time of both, certificate, and key files.
+func (r *Reloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+//////
+// Methods.
+//////
+
+// Reload loads the key pair from disk, if it changed since the last load.
+func (r *Reloader) Reload() error {
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		return customerror.NewFailedToError("stat certificate files", customerror.WithError(err))
+	}
+
+	r.m.RLock()
+	unchanged := r.certificate != nil &&
+		certModTime.Equal(r.certModTime) &&
+		keyModTime.Equal(r.keyModTime)
+	r.m.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return customerror.NewFailedToError("load certificate", customerror.WithError(err))
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.certificate = &certificate
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+
+	return nil
+}
+
+// GetCertificate returns the current certificate. It satisfies
+// `tls.Config.GetCertificate`.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.certificate, nil
+}
+
+// Watch checks the files every `interval` for changes, until `ctx` is done.
+// Failed reloads are reported to `onError`, and the current certificate is
+// kept in use.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+//////
+// Factory.
+//////
+
+// New is the Reloader factory. It loads the key pair right away.
+func New(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,3 @@
+// Package certificate provides TLS certificates which are automatically
+// reloaded from disk when they change, allowing rotation without restarts.
+package certificate
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+)
+
+//////
+// Consts, and vars.
+//////
+
+// Context key type, avoids collisions with keys from other packages.
+type contextKey string
+
+const identityContextKey contextKey = "identity"
+
+//////
+// Definition.
+//////
+
+// Identity is the verified identity of a client which authenticated with a
+// certificate (mTLS).
+type Identity struct {
+	// CommonName of the certificate subject.
+	CommonName string `json:"common_name"`
+
+	// DNSNames from the certificate SANs.
+	DNSNames []string `json:"dns_names"`
+
+	// EmailAddresses from the certificate SANs.
+	EmailAddresses []string `json:"email_addresses"`
+
+	// IPAddresses from the certificate SANs.
+	IPAddresses []string `json:"ip_addresses"`
+
+	// Issuer of the certificate.
+	Issuer string `json:"issuer"`
+
+	// SerialNumber of the certificate.
+	SerialNumber string `json:"serial_number"`
+
+	// Subject of the certificate, e.g.: "CN=svc,O=org".
+	Subject string `json:"subject"`
+
+	// URIs from the certificate SANs, e.g.: SPIFFE IDs.
+	URIs []string `json:"uris"`
+}
+
+// Name returns the most meaningful name of the identity: the common name, or
+// the first SAN.
+func (i *Identity) Name() string {
+	switch {
+	case i.CommonName != "":
+		return i.CommonName
+	case len(i.URIs) > 0:
+		return i.URIs[0]
+	case len(i.DNSNames) > 0:
+		return i.DNSNames[0]
+	case len(i.EmailAddresses) > 0:
+		return i.EmailAddresses[0]
+	case len(i.IPAddresses) > 0:
+		return i.IPAddresses[0]
+	default:
+		return i.Subject
+	}
+}
+
+//////
+// Helpers.
+//////
+
+// Builds an `Identity` from a verified certificate.
+func newIdentity(cert *x509.Certificate) *Identity {
+	identity := &Identity{
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    []string{},
+		Issuer:         cert.Issuer.String(),
+		SerialNumber:   cert.SerialNumber.String(),
+		Subject:        cert.Subject.String(),
+		URIs:           []string{},
+	}
+
+	for _, ip := range cert.IPAddresses {
+		identity.IPAddresses = append(identity.IPAddresses, ip.String())
+	}
+
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+
+	return identity
+}
+
+// IdentityFromContext returns the client identity stored in `ctx`, if any.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityContextKey).(*Identity)
+
+	return identity, ok
+}
+
+// ClientIdentity extracts the identity of a client which authenticated with a
+// verified certificate, storing it in the request context. The identity name
+// is also set as the request user, so it's logged as the Apache Combined Log
+// Format "userid".
+//
+// NOTE: It must be registered before the `Logger` middleware.
+func ClientIdentity() mux.MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				h.ServeHTTP(w, r)
+
+				return
+			}
+
+			identity := newIdentity(r.TLS.VerifiedChains[0][0])
+
+			r.URL.User = url.User(identity.Name())
+
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityContextKey, identity)))
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+	"github.com/thalesfsp/webserver/metric"
+)
+
+// Label of requests without a matching route, e.g.: `404`, and `405`.
+const unmatchedRoute = "unmatched"
+
+// Request, and response size buckets, in bytes.
+var sizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7, 1e8}
+
+// HTTPMetrics are the RED (Rate, Errors, Duration) metrics of a server.
+// Routes are identified by their template, e.g.: `/users/{id}`, keeping the
+// cardinality low.
+type HTTPMetrics struct {
+	// Duration of requests, in seconds, by method, route, and status class.
+	Duration *metric.HistogramVec
+
+	// Errors (5xx) by method, and route.
+	Errors *metric.CounterVec
+
+	// InFlight is the number of requests being served.
+	InFlight *metric.Int
+
+	// Requests by method, route, and status class.
+	Requests *metric.CounterVec
+
+	// RequestSize of requests, in bytes, by method, and route.
+	RequestSize *metric.HistogramVec
+
+	// ResponseSize of responses, in bytes, by method, and route.
+	ResponseSize *metric.HistogramVec
+}
+
+// NewHTTPMetrics creates the HTTP metrics, publishing them into `registry`.
+func NewHTTPMetrics(registry *metric.Registry) (*HTTPMetrics, error) {
+	m := &HTTPMetrics{
+		Duration:     new(metric.HistogramVec).Init(metric.DefaultBuckets, "method", "route", "status_class"),
+		Errors:       new(metric.CounterVec).Init("method", "route"),
+		InFlight:     new(metric.Int),
+		Requests:     new(metric.CounterVec).Init("method", "route", "status_class"),
+		RequestSize:  new(metric.HistogramVec).Init(sizeBuckets, "method", "route"),
+		ResponseSize: new(metric.HistogramVec).Init(sizeBuckets, "method", "route"),
+	}
+
+	for name, v := range map[string]metric.Var{
+		"http_request_duration_seconds": m.Duration,
+		"http_request_errors_total":     m.Errors,
+		"http_requests_in_flight":       m.InFlight,
+		"http_requests_total":           m.Requests,
+		"http_request_size_bytes":       m.RequestSize,
+		"http_response_size_bytes":      m.ResponseSize,
+	} {
+		if err := registry.Publish(name, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Counts bytes read from the request body.
+type countingReader struct {
+	io.ReadCloser
+
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+
+	atomic.AddInt64(&c.n, int64(n))
+
+	return n, err
+}
+
+// Returns the status class of `code`, e.g.: `2xx`.
+func statusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// Metrics records the RED metrics of requests. The `http.ResponseWriter`
+// capabilities (e.g.: `http.Flusher`, and `http.Hijacker`) are preserved.
+func Metrics(m *HTTPMetrics) mux.MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := unmatchedRoute
+
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+
+			// Unknown length (e.g.: chunked), so it's counted while read.
+			var body *countingReader
+
+			if r.ContentLength < 0 && r.Body != nil {
+				body = &countingReader{ReadCloser: r.Body}
+
+				r.Body = body
+			}
+
+			m.InFlight.Add(1)
+			defer m.InFlight.Add(-1)
+
+			began := time.Now()
+
+			snoop := httpsnoop.CaptureMetricsFn(w, func(w http.ResponseWriter) {
+				h.ServeHTTP(w, r)
+			})
+
+			requestSize := r.ContentLength
+
+			if body != nil {
+				requestSize = atomic.LoadInt64(&body.n)
+			}
+
+			class := statusClass(snoop.Code)
+
+			m.Requests.Add(1, r.Method, route, class)
+
+			if snoop.Code >= http.StatusInternalServerError {
+				m.Errors.Add(1, r.Method, route)
+			}
+
+			m.Duration.Observe(time.Since(began).Seconds(), r.Method, route, class)
+			m.RequestSize.Observe(float64(requestSize), r.Method, route)
+			m.ResponseSize.Observe(float64(snoop.Written), r.Method, route)
+		})
+	}
+}
@@ -1,16 +1,68 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/thalesfsp/sypl"
+	"github.com/thalesfsp/sypl/fields"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Log requests in the Apache Combined Log Format.
+const loggerContextKey contextKey = "logger"
+
+// LoggerFromContext returns the request-scoped logger stored in `ctx`, if
+// any.
+func LoggerFromContext(ctx context.Context) (sypl.ISypl, bool) {
+	l, ok := ctx.Value(loggerContextKey).(sypl.ISypl)
+
+	return l, ok
+}
+
+// RequestLogger stores a request-scoped logger in the request context. If the
+// request is traced, its logs carry the `trace_id`, and `span_id` fields.
+//
+// NOTE: It must be registered after the telemetry middleware.
+func RequestLogger(l sypl.ISypl) mux.MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var requestLogger sypl.ISypl = l
+
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+				// Child shares outputs, fields are copied, not mutated.
+				f := fields.Fields{}
+
+				for k, v := range l.GetFields() {
+					f[k] = v
+				}
+
+				f["trace_id"] = sc.TraceID().String()
+				f["span_id"] = sc.SpanID().String()
+
+				requestLogger = l.New(l.GetName()).SetFields(f)
+			}
+
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), loggerContextKey, requestLogger)))
+		})
+	}
+}
+
+// Log requests in the Apache Combined Log Format. Requests are logged by
+// the request-scoped logger, if any.
 func Logger(l sypl.ISypl) mux.MiddlewareFunc {
 	return func(h http.Handler) http.Handler {
-		return handlers.CombinedLoggingHandler(l, h)
+		logged := handlers.CombinedLoggingHandler(l, h)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requestLogger, ok := LoggerFromContext(r.Context()); ok && requestLogger != l {
+				handlers.CombinedLoggingHandler(requestLogger, h).ServeHTTP(w, r)
+
+				return
+			}
+
+			logged.ServeHTTP(w, r)
+		})
 	}
 }
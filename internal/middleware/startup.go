@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Starting replies with `err` as JSON until `started` reports true, so
+// traffic is only served once warm-up work completed. Requests `bypass`
+// reports, e.g.: probes, are always served.
+func Starting(started func() bool, bypass func(r *http.Request) bool, err error) mux.MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !started() && !bypass(r) {
+				WriteError(w, err)
+
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
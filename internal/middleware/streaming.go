@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const connContextKey contextKey = "conn"
+
+// ContextWithConn stores the connection in the context. It satisfies
+// `http.Server.ConnContext`.
+func ContextWithConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey, c)
+}
+
+// ConnFromContext returns the connection stored in `ctx`, if any.
+func ConnFromContext(ctx context.Context) (net.Conn, bool) {
+	c, ok := ctx.Value(connContextKey).(net.Conn)
+
+	return c, ok
+}
+
+// Streaming clears the connection read, and write deadlines of streaming
+// requests (e.g.: SSE, WebSocket), so long-lived responses aren't cut by the
+// server `ReadTimeout`, and `WriteTimeout`. `isStreaming` determines if a
+// request is streaming. Their context is also cancelled once the one returned
+// by `streams` is, e.g.: when the server starts draining, as they would
+// otherwise hold the shutdown.
+//
+// NOTE: Requires `ContextWithConn` to be set as `http.Server.ConnContext`.
+func Streaming(isStreaming func(r *http.Request) bool, streams func() context.Context) mux.MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isStreaming(r) {
+				h.ServeHTTP(w, r)
+
+				return
+			}
+
+			if c, ok := ConnFromContext(r.Context()); ok {
+				_ = c.SetDeadline(time.Time{})
+			}
+
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+
+			stop := streams()
+
+			go func() {
+				select {
+				case <-stop.Done():
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
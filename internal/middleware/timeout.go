@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Definitions.
+//////
+
+// JSON representation of an error response.
+type errorResponse struct {
+	// Message of the error.
+	Message string `json:"message"`
+
+	// StatusCode of the response.
+	StatusCode int `json:"status_code"`
+}
+
+// Buffers the response, so it can be discarded if the request times out.
+//
+// NOTE: Based on Go's `http.TimeoutHandler`.
+type timeoutWriter struct {
+	w    http.ResponseWriter
+	h    http.Header
+	wbuf bytes.Buffer
+
+	mu          sync.Mutex
+	err         error
+	wroteHeader bool
+	code        int
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.h }
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.err != nil {
+		return 0, tw.err
+	}
+
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+
+	return tw.wbuf.Write(p)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	if tw.err != nil || tw.wroteHeader {
+		return
+	}
+
+	tw.wroteHeader = true
+	tw.code = code
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.writeHeaderLocked(code)
+}
+
+//////
+// Helpers.
+//////
+
+// WriteError replies with `err` as JSON. The status code is the one from the
+// custom error, otherwise `500`.
+func WriteError(w http.ResponseWriter, err error) {
+	statusCode := http.StatusInternalServerError
+
+	var customErr *customerror.CustomError
+
+	if errors.As(err, &customErr) && customErr.StatusCode != 0 {
+		statusCode = customErr.StatusCode
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	w.WriteHeader(statusCode)
+
+	_ = json.NewEncoder(w).Encode(errorResponse{
+		Message:    err.Error(),
+		StatusCode: statusCode,
+	})
+}
+
+// Timeout sets a deadline for the request context, and replies with `err` as
+// JSON if the handler doesn't finish in time. The response is buffered until
+// the handler finishes. `timeoutOf` determines the timeout of each request,
+// zero, or negative disables it.
+func Timeout(timeoutOf func(r *http.Request) time.Duration, err error) mux.MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := timeoutOf(r)
+
+			if timeout <= 0 {
+				h.ServeHTTP(w, r)
+
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			r = r.WithContext(ctx)
+
+			done := make(chan struct{})
+			panicChan := make(chan interface{}, 1)
+
+			tw := &timeoutWriter{
+				w: w,
+				h: make(http.Header),
+			}
+
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicChan <- p
+					}
+				}()
+
+				h.ServeHTTP(tw, r)
+
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				dst := w.Header()
+
+				for k, vv := range tw.h {
+					dst[k] = vv
+				}
+
+				if !tw.wroteHeader {
+					tw.code = http.StatusOK
+				}
+
+				w.WriteHeader(tw.code)
+
+				_, _ = w.Write(tw.wbuf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					WriteError(w, err)
+
+					tw.err = http.ErrHandlerTimeout
+
+					return
+				}
+
+				// Client went away.
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				tw.err = ctx.Err()
+			}
+		})
+	}
+}
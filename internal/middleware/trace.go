@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceHeaders sets response headers carrying the IDs of the request span:
+// the trace ID in `traceIDHeader`, the span ID in `spanIDHeader`, and, if
+// `traceparent` is true, the W3C `traceparent` header. Empty header names are
+// skipped.
+//
+// NOTE: It must be registered after the telemetry middleware.
+func TraceHeaders(traceIDHeader, spanIDHeader string, traceparent bool) mux.MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sc := trace.SpanContextFromContext(r.Context())
+
+			if sc.IsValid() {
+				if traceIDHeader != "" {
+					w.Header().Set(traceIDHeader, sc.TraceID().String())
+				}
+
+				if spanIDHeader != "" {
+					w.Header().Set(spanIDHeader, sc.SpanID().String())
+				}
+
+				if traceparent {
+					propagation.TraceContext{}.Inject(r.Context(), propagation.HeaderCarrier(w.Header()))
+				}
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
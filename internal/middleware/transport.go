@@ -0,0 +1,296 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thalesfsp/webserver/metric"
+)
+
+// Label of requests which failed without a response, e.g.: connection
+// refused.
+const failedStatusClass = "failed"
+
+// Methods which can be safely retried.
+var idempotentMethods = map[string]bool{
+	http.MethodDelete:  true,
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodTrace:   true,
+}
+
+// Statuses which are worth a retry.
+var retryableStatuses = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// RoundTripperFunc allows a function to be used as `http.RoundTripper`.
+type RoundTripperFunc func(r *http.Request) (*http.Response, error)
+
+// RoundTrip satisfies the `http.RoundTripper` interface.
+func (f RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+//////
+// Metrics.
+//////
+
+// HTTPClientMetrics are the RED (Rate, Errors, Duration) metrics of outbound
+// requests. Requests are identified by the called host, keeping the
+// cardinality low.
+type HTTPClientMetrics struct {
+	// Duration of requests, including retries, in seconds, by method, host,
+	// and status class.
+	Duration *metric.HistogramVec
+
+	// Errors (failed, or 5xx) by method, and host.
+	Errors *metric.CounterVec
+
+	// InFlight is the number of outbound requests.
+	InFlight *metric.Int
+
+	// Requests by method, host, and status class.
+	Requests *metric.CounterVec
+
+	// Retries by method, and host.
+	Retries *metric.CounterVec
+}
+
+// NewHTTPClientMetrics creates the HTTP client metrics, publishing them into
+// `registry`.
+func NewHTTPClientMetrics(registry *metric.Registry) (*HTTPClientMetrics, error) {
+	m := &HTTPClientMetrics{
+		Duration: new(metric.HistogramVec).Init(metric.DefaultBuckets, "method", "host", "status_class"),
+		Errors:   new(metric.CounterVec).Init("method", "host"),
+		InFlight: new(metric.Int),
+		Requests: new(metric.CounterVec).Init("method", "host", "status_class"),
+		Retries:  new(metric.CounterVec).Init("method", "host"),
+	}
+
+	for name, v := range map[string]metric.Var{
+		"http_client_request_duration_seconds": m.Duration,
+		"http_client_request_errors_total":     m.Errors,
+		"http_client_requests_in_flight":       m.InFlight,
+		"http_client_requests_total":           m.Requests,
+		"http_client_retries_total":            m.Retries,
+	} {
+		if err := registry.Publish(name, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// ClientMetrics records the RED metrics of outbound requests sent through
+// `next`.
+func ClientMetrics(m *HTTPClientMetrics, next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		m.InFlight.Add(1)
+		defer m.InFlight.Add(-1)
+
+		began := time.Now()
+
+		resp, err := next.RoundTrip(r)
+
+		class := failedStatusClass
+
+		if err == nil {
+			class = statusClass(resp.StatusCode)
+		}
+
+		m.Requests.Add(1, r.Method, r.URL.Host, class)
+
+		if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+			m.Errors.Add(1, r.Method, r.URL.Host)
+		}
+
+		m.Duration.Observe(time.Since(began).Seconds(), r.Method, r.URL.Host, class)
+
+		return resp, err
+	})
+}
+
+//////
+// Retry.
+//////
+
+// Cancels the attempt context once the body is closed, so it can be read
+// after `RoundTrip` returns.
+type cancelBody struct {
+	io.ReadCloser
+
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+
+	return b.ReadCloser.Close()
+}
+
+// Returns the exponential backoff, with full jitter, of `attempt` (0-based),
+// up to `max`.
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	if base <= 0 || max <= 0 {
+		return 0
+	}
+
+	ceiling := max
+
+	// Avoids overflowing.
+	if attempt < 63 && base <= max>>attempt {
+		ceiling = base << attempt
+	}
+
+	n := int64(ceiling)
+
+	if n < math.MaxInt64 {
+		n++
+	}
+
+	return time.Duration(rand.Int63n(n)) //nolint:gosec
+}
+
+// Returns whether `r` can be sent again.
+func isRetryable(r *http.Request) bool {
+	return idempotentMethods[r.Method] && (r.Body == nil || r.Body == http.NoBody || r.GetBody != nil)
+}
+
+// Returns how long the server asked to wait before retrying, if it did via
+// `Retry-After`, in seconds, or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, true
+		}
+
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// Returns whether a retry, after waiting `wait`, finishes before `ctx` is done.
+func canRetry(ctx context.Context, wait time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	deadline, ok := ctx.Deadline()
+
+	return !ok || time.Until(deadline) > wait
+}
+
+// Retry sends requests through `next`, bounding each attempt by `timeout`, if
+// positive. The deadline of the request context, if any, takes precedence, so
+// an outbound request never outlives the inbound one. Failed, or unavailable
+// (429, 502, 503, and 504) idempotent requests are retried up to `retries`
+// times, with an exponential backoff starting at `base`, up to `maxWait` - or
+// after the `Retry-After` of 429, and 503 responses. A retry which wouldn't
+// start before the deadline, or after waiting more than `maxWait`, isn't
+// attempted. `onRetry`, if not nil,
+// is called before every retry.
+func Retry(next http.RoundTripper, timeout time.Duration, retries int, base, maxWait time.Duration, onRetry func(r *http.Request)) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		maxRetries := retries
+
+		if !isRetryable(r) {
+			maxRetries = 0
+		}
+
+		for attempt := 0; ; attempt++ {
+			req := r
+
+			if attempt > 0 && r.GetBody != nil {
+				body, err := r.GetBody()
+				if err != nil {
+					return nil, err
+				}
+
+				req = r.Clone(r.Context())
+				req.Body = body
+			}
+
+			var (
+				ctx    context.Context
+				cancel context.CancelFunc
+			)
+
+			if timeout > 0 {
+				ctx, cancel = context.WithTimeout(req.Context(), timeout)
+			} else {
+				ctx, cancel = context.WithCancel(req.Context())
+			}
+
+			resp, err := next.RoundTrip(req.WithContext(ctx))
+
+			wait := backoff(base, maxWait, attempt)
+
+			if err == nil {
+				if after, ok := retryAfter(resp); ok {
+					wait = after
+				}
+			}
+
+			if attempt >= maxRetries ||
+				(err == nil && !retryableStatuses[resp.StatusCode]) ||
+				wait > maxWait ||
+				!canRetry(r.Context(), wait) {
+				if err != nil {
+					cancel()
+
+					return nil, err
+				}
+
+				resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+				return resp, nil
+			}
+
+			// Allows connections reuse.
+			if err == nil {
+				_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+				resp.Body.Close()
+			}
+
+			cancel()
+
+			timer := time.NewTimer(wait)
+
+			select {
+			case <-r.Context().Done():
+				timer.Stop()
+
+				return nil, r.Context().Err()
+			case <-timer.C:
+			}
+
+			if onRetry != nil {
+				onRetry(r)
+			}
+		}
+	})
+}
@@ -0,0 +1,3 @@
+// Package runner runs cancellable work, e.g.: shutdown tasks, startup hooks,
+// and readiness checks.
+package runner
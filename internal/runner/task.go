@@ -0,0 +1,39 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package runner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/thalesfsp/customerror"
+)
+
+// Run runs `fn`, returning as soon as it finishes, or `ctx` is done - whatever
+// happens first. A panic in `fn` is returned as an error.
+func Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- customerror.NewFailedToError(fmt.Sprintf("run task, panic: %v", r))
+			}
+		}()
+
+		errCh <- fn(ctx)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package webserver
+
+import (
+	"context"
+
+	"github.com/thalesfsp/sypl"
+	"github.com/thalesfsp/webserver/internal/middleware"
+)
+
+// LoggerFromContext returns the request-scoped logger from the request
+// context. If telemetry is enabled, its logs carry the `trace_id`, and
+// `span_id` fields of the request, correlating them with the access log, and
+// spans.
+func LoggerFromContext(ctx context.Context) (sypl.ISypl, bool) {
+	return middleware.LoggerFromContext(ctx)
+}
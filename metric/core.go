@@ -23,10 +23,15 @@ import (
 //////
 
 func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, Do)
+}
+
+// Writes the variables iterated by `do` as JSON.
+func writeJSON(w http.ResponseWriter, do func(func(KeyValue))) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	fmt.Fprintf(w, "{\n")
 	first := true
-	Do(func(kv KeyValue) {
+	do(func(kv KeyValue) {
 		if !first {
 			fmt.Fprintf(w, ",\n")
 		}
@@ -287,48 +292,34 @@ func (f Func) String() string {
 	return string(v)
 }
 
-// All published variables.
-var (
-	vars      sync.Map // map[string]Var
-	varKeysMu sync.RWMutex
-	varKeys   []string // sorted
-)
-
 //////
 // Static methods.
+//
+// They operate on the package-level registry, see `Default`.
 //////
 
 // Publish declares a named exported variable. This should be called from a
 // package's init function when it creates its Vars. If the name is already
 // registered then this will log.Panic.
+//
+// NOTE: Use `Registry.Publish` to get an error instead.
 func Publish(name string, v Var) {
-	if _, dup := vars.LoadOrStore(name, v); dup {
+	if err := defaultRegistry.Publish(name, v); err != nil {
 		log.Panicln("Reuse of exported var name:", name)
 	}
-	varKeysMu.Lock()
-	defer varKeysMu.Unlock()
-	varKeys = append(varKeys, name)
-	sort.Strings(varKeys)
 }
 
 // Get retrieves a named exported variable. It returns nil if the name has
 // not been registered.
 func Get(name string) Var {
-	i, _ := vars.Load(name)
-	v, _ := i.(Var)
-	return v
+	return defaultRegistry.Get(name)
 }
 
 // Do calls f for each exported variable.
 // The global variable map is locked during the iteration,
 // but existing entries may be concurrently updated.
 func Do(f func(KeyValue)) {
-	varKeysMu.RLock()
-	defer varKeysMu.RUnlock()
-	for _, k := range varKeys {
-		val, _ := vars.Load(k)
-		f(KeyValue{k, val.(Var)})
-	}
+	defaultRegistry.Do(f)
 }
 
 // Handler returns the metrics HTTP Handler.
@@ -385,6 +376,8 @@ func PublishCommandLine() {
 }
 
 // MemoryStats metric.
+//
+// NOTE: It stops the world on every read, prefer `NewRuntimeCollector`.
 func MemoryStats() Func {
 	return func() interface{} {
 		stats := new(runtime.MemStats)
@@ -0,0 +1,192 @@
+package metric
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//////
+// Consts, and vars.
+//////
+
+// DefaultBuckets are the default histogram buckets, tailored to measure
+// latencies in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//////
+// Histogram type.
+//////
+
+// Histogram counts observations in configurable buckets. It satisfies the Var,
+// and Collector interfaces. It's safe for concurrent use. The zero value uses
+// `DefaultBuckets`, `Init` sets others - before use.
+type Histogram struct {
+	// First, so it's 64-bit aligned for atomic operations.
+	count uint64
+
+	// Upper bounds, sorted.
+	buckets []float64
+
+	// Per bucket counts, not cumulative. The last one is `+Inf`.
+	counts []uint64
+
+	// Initializes the zero value.
+	once sync.Once
+
+	sum Float
+}
+
+// Init sets the buckets upper bounds, and resets the histogram. If none is
+// passed, `DefaultBuckets` is used.
+func (h *Histogram) Init(buckets ...float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	h.buckets = make([]float64, 0, len(buckets))
+
+	for _, b := range buckets {
+		if !math.IsInf(b, 1) {
+			h.buckets = append(h.buckets, b)
+		}
+	}
+
+	sort.Float64s(h.buckets)
+
+	h.counts = make([]uint64, len(h.buckets)+1)
+	h.count = 0
+	h.sum.Set(0)
+
+	return h
+}
+
+// Observe adds `value` to the histogram.
+func (h *Histogram) Observe(value float64) {
+	h.lazyInit()
+
+	// First bucket which upper bound is >= value, or `+Inf`.
+	i := sort.SearchFloat64s(h.buckets, value)
+
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+
+	h.sum.Add(value)
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+// Sum returns the sum of observations.
+func (h *Histogram) Sum() float64 {
+	return h.sum.Value()
+}
+
+// Buckets returns the upper bounds, and their cumulative counts. The last
+// one is `+Inf`.
+func (h *Histogram) Buckets() ([]float64, []uint64) {
+	h.lazyInit()
+
+	bounds := append(append(make([]float64, 0, len(h.buckets)+1), h.buckets...), math.Inf(1))
+
+	cumulative := make([]uint64, len(h.counts))
+
+	var total uint64
+
+	for i := range h.counts {
+		total += atomic.LoadUint64(&h.counts[i])
+
+		cumulative[i] = total
+	}
+
+	return bounds, cumulative
+}
+
+func (h *Histogram) String() string {
+	bounds, counts := h.Buckets()
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `{"buckets": {`)
+
+	for i, bound := range bounds {
+		if i > 0 {
+			fmt.Fprintf(&b, ", ")
+		}
+
+		fmt.Fprintf(&b, "%q: %d", formatValue(bound), counts[i])
+	}
+
+	fmt.Fprintf(&b, `}, "count": %d, "sum": %s}`, counts[len(counts)-1], jsonFloat(h.Sum()))
+
+	return b.String()
+}
+
+// Collect satisfies the Collector interface.
+func (h *Histogram) Collect(name string) []Family {
+	return []Family{{
+		Name:    name,
+		Samples: h.samples(name, nil),
+		Type:    TypeHistogram,
+	}}
+}
+
+// Samples of the histogram, with `labels`.
+func (h *Histogram) samples(name string, labels []Label) []Sample {
+	bounds, counts := h.Buckets()
+
+	samples := make([]Sample, 0, len(bounds)+2)
+
+	for i, bound := range bounds {
+		samples = append(samples, Sample{
+			Labels: withLabel(labels, "le", formatValue(bound)),
+			Name:   name + "_bucket",
+			Value:  float64(counts[i]),
+		})
+	}
+
+	return append(samples,
+		Sample{Labels: labels, Name: name + "_sum", Value: h.Sum()},
+		Sample{Labels: labels, Name: name + "_count", Value: float64(counts[len(counts)-1])},
+	)
+}
+
+// Sets `DefaultBuckets`, unless `Init` was called.
+func (h *Histogram) lazyInit() {
+	h.once.Do(func() {
+		if h.counts == nil {
+			h.Init()
+		}
+	})
+}
+
+//////
+// Helpers.
+//////
+
+// Formats `v` as JSON. JSON doesn't support `NaN`, and infinities, so they
+// are quoted.
+func jsonFloat(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.Quote(formatValue(v))
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+//////
+// Factory.
+//////
+
+// NewHistogram creates, and publishes a histogram.
+func NewHistogram(name string, buckets ...float64) *Histogram {
+	v := new(Histogram).Init(buckets...)
+	Publish(name, v)
+	return v
+}
@@ -0,0 +1,233 @@
+package metric
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := new(Histogram).Init(1, 0.1, 0.5)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 1000; j++ {
+				h.Observe(0.05)
+				h.Observe(0.3)
+				h.Observe(5)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	bounds, counts := h.Buckets()
+
+	wantBounds := []float64{0.1, 0.5, 1, math.Inf(1)}
+	wantCounts := []uint64{8000, 16000, 16000, 24000}
+
+	for i := range wantBounds {
+		if bounds[i] != wantBounds[i] || counts[i] != wantCounts[i] {
+			t.Fatalf("Buckets() = %v %v, want %v %v", bounds, counts, wantBounds, wantCounts)
+		}
+	}
+
+	if h.Count() != 24000 {
+		t.Fatalf("Count() = %d, want 24000", h.Count())
+	}
+
+	if got := h.Sum(); math.Abs(got-8000*5.35) > 1e-6 {
+		t.Fatalf("Sum() = %v, want %v", got, 8000*5.35)
+	}
+
+	if !json.Valid([]byte(h.String())) {
+		t.Fatalf("String() isn't valid JSON: %s", h.String())
+	}
+
+	var buf bytes.Buffer
+
+	if err := WritePrometheus(&buf, h.Collect("latency"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"# TYPE latency histogram\n",
+		`latency_bucket{le="0.1"} 8000` + "\n",
+		`latency_bucket{le="+Inf"} 24000` + "\n",
+		"latency_count 24000\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("Expected %q in:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	s := new(Summary).Init(time.Minute, 0.5, 0.9)
+
+	now := time.Now()
+
+	s.now = func() time.Time { return now }
+
+	for i := 1; i <= 100; i++ {
+		s.Observe(float64(i))
+	}
+
+	_, values := s.Quantiles()
+
+	if values[0] != 50 || values[1] != 90 {
+		t.Fatalf("Quantiles() = %v, want [50 90]", values)
+	}
+
+	if !json.Valid([]byte(s.String())) {
+		t.Fatalf("String() isn't valid JSON: %s", s.String())
+	}
+
+	// Once the window slides, old observations are gone.
+	now = now.Add(2 * time.Minute)
+
+	_, values = s.Quantiles()
+
+	if !math.IsNaN(values[0]) {
+		t.Fatalf("Quantiles() = %v, want NaN", values)
+	}
+
+	if s.Count() != 100 {
+		t.Fatalf("Count() = %d, want 100", s.Count())
+	}
+
+	if !json.Valid([]byte(s.String())) {
+		t.Fatalf("String() isn't valid JSON: %s", s.String())
+	}
+}
+
+func TestSummary_sampling(t *testing.T) {
+	s := new(Summary).Init(time.Minute, 0.5)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 10000; j++ {
+				s.Observe(float64(j % 100))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// Sampled, so approximated.
+	if _, values := s.Quantiles(); math.Abs(values[0]-50) > 10 {
+		t.Fatalf("Quantiles() = %v, want ~50", values)
+	}
+}
+
+func TestHistogram_zeroValue(t *testing.T) {
+	var (
+		h  Histogram
+		s  Summary
+		cv CounterVec
+		hv HistogramVec
+	)
+
+	h.Observe(0.2)
+	s.Observe(0.2)
+	cv.Add(2, "ignored")
+	hv.Observe(0.2)
+
+	if got := cv.WithLabelValues().Value(); got != 2 {
+		t.Fatalf("CounterVec = %v, want 2", got)
+	}
+
+	if bounds, counts := hv.WithLabelValues().Buckets(); len(bounds) != len(DefaultBuckets)+1 || counts[len(counts)-1] != 1 {
+		t.Fatalf("HistogramVec Buckets() = %v, %v, want default buckets, and 1 observation", bounds, counts)
+	}
+
+	if bounds, counts := h.Buckets(); len(bounds) != len(DefaultBuckets)+1 || counts[len(counts)-1] != 1 {
+		t.Fatalf("Buckets() = %v, %v, want default buckets, and 1 observation", bounds, counts)
+	}
+
+	if quantiles, values := s.Quantiles(); len(quantiles) != len(DefaultQuantiles) || values[0] != 0.2 {
+		t.Fatalf("Quantiles() = %v, %v, want default quantiles", quantiles, values)
+	}
+
+	for _, v := range []Var{new(Histogram), new(Summary), new(CounterVec), new(HistogramVec)} {
+		if !json.Valid([]byte(v.String())) {
+			t.Fatalf("String() isn't valid JSON: %s", v.String())
+		}
+	}
+}
+
+func TestVec(t *testing.T) {
+	requests := new(CounterVec).Init("method", "code")
+	latency := new(HistogramVec).Init([]float64{0.1}, "route")
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				requests.Add(1, "GET", "200")
+				requests.WithLabelValues("POST", "500").Add(1)
+				latency.Observe(0.05, "/users/{id}")
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if got := requests.WithLabelValues("GET", "200").Value(); got != 800 {
+		t.Fatalf("Expected 800, got %d", got)
+	}
+
+	for _, v := range []Var{requests, latency} {
+		if !json.Valid([]byte(v.String())) {
+			t.Fatalf("String() isn't valid JSON: %s", v.String())
+		}
+	}
+
+	vars := []KeyValue{
+		{Key: "requests_total", Value: requests},
+		{Key: "latency", Value: latency},
+	}
+
+	var buf bytes.Buffer
+
+	if err := WritePrometheus(&buf, gather(func(f func(KeyValue)) {
+		for _, kv := range vars {
+			f(kv)
+		}
+	}), false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"# TYPE requests_total counter\n",
+		`requests_total{method="GET",code="200"} 800` + "\n",
+		`requests_total{method="POST",code="500"} 800` + "\n",
+		`latency_bucket{route="/users/{id}",le="0.1"} 800` + "\n",
+		`latency_count{route="/users/{id}"} 800` + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("Expected %q in:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package metric
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+)
+
+//////
+// Consts, and vars.
+//////
+
+// Name of the meter of the bridged metrics.
+const otelMeterName = "github.com/thalesfsp/webserver/metric"
+
+//////
+// Definitions.
+//////
+
+// Observes the value of a sample.
+type otelObserver interface {
+	Observe(ctx context.Context, x float64, attrs ...attribute.KeyValue)
+}
+
+// OTelBridge exposes published variables through an OpenTelemetry
+// `MeterProvider`, as asynchronous instruments observed on every collection.
+// Counters, and histograms buckets, sums, and counts become counters,
+// everything else gauges. Histograms buckets are observed as `<name>_bucket`
+// with the `le` attribute, same as in the Prometheus format.
+//
+// NOTE: Instruments are created for variables published when the bridge is
+// created. Call `Refresh` after publishing new ones.
+type OTelBridge struct {
+	instruments map[string]otelObserver
+	m           sync.Mutex
+	meter       otelmetric.Meter
+	registries  []*Registry
+}
+
+// Observes the samples named `names`. Each callback observes the instruments
+// it was registered with, so they are observed once per collection.
+func (b *OTelBridge) observe(ctx context.Context, names map[string]struct{}) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for _, f := range gather(doAll(b.registries)) {
+		for _, s := range f.Samples {
+			if _, ok := names[s.Name]; !ok {
+				continue
+			}
+
+			i := b.instruments[s.Name]
+
+			attrs := make([]attribute.KeyValue, 0, len(s.Labels))
+
+			for _, l := range s.Labels {
+				attrs = append(attrs, attribute.String(l.Name, l.Value))
+			}
+
+			i.Observe(ctx, s.Value, attrs...)
+		}
+	}
+}
+
+// Refresh creates instruments for variables published since the bridge was
+// created, or last refreshed.
+func (b *OTelBridge) Refresh() error {
+	created, names, err := b.createInstruments()
+	if err != nil {
+		return err
+	}
+
+	if len(created) == 0 {
+		return nil
+	}
+
+	// Not holding the lock, as providers may collect while registering.
+	return b.meter.RegisterCallback(created, func(ctx context.Context) {
+		b.observe(ctx, names)
+	})
+}
+
+// Creates instruments for samples which don't have one, returning them, and
+// their names.
+func (b *OTelBridge) createInstruments() ([]instrument.Asynchronous, map[string]struct{}, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	created := []instrument.Asynchronous{}
+	names := map[string]struct{}{}
+
+	for _, f := range gather(doAll(b.registries)) {
+		for _, s := range f.Samples {
+			if _, ok := b.instruments[s.Name]; ok {
+				continue
+			}
+
+			opts := []instrument.Option{instrument.WithDescription(f.Help)}
+
+			var (
+				i   otelObserver
+				err error
+			)
+
+			if f.isCumulative(s) {
+				i, err = b.meter.AsyncFloat64().Counter(s.Name, opts...)
+			} else {
+				i, err = b.meter.AsyncFloat64().Gauge(s.Name, opts...)
+			}
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			b.instruments[s.Name] = i
+			names[s.Name] = struct{}{}
+
+			created = append(created, i.(instrument.Asynchronous))
+		}
+	}
+
+	return created, names, nil
+}
+
+//////
+// Factory.
+//////
+
+// NewOTelBridge is the OTelBridge factory. Variables of `registries` are
+// exposed through `provider`, if a name is published in more than one, the
+// first registry wins, default: the package-level registry.
+//
+// NOTE: Readers, and exporters (e.g.: OTLP, and Prometheus) are configured in
+// the provider.
+func NewOTelBridge(provider otelmetric.MeterProvider, registries ...*Registry) (*OTelBridge, error) {
+	if len(registries) == 0 {
+		registries = []*Registry{defaultRegistry}
+	}
+
+	b := &OTelBridge{
+		instruments: map[string]otelObserver{},
+		meter:       provider.Meter(otelMeterName),
+		registries:  registries,
+	}
+
+	if err := b.Refresh(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
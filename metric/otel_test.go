@@ -0,0 +1,185 @@
+package metric
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/asyncfloat64"
+)
+
+// Records observations of asynchronous instruments, collected on demand.
+type fakeMeter struct {
+	otelmetric.Meter
+
+	callbacks []func(context.Context)
+	kinds     map[string]string
+	m         sync.Mutex
+	observed  map[string][]float64
+}
+
+type fakeInstrument struct {
+	instrument.Asynchronous
+
+	meter *fakeMeter
+	name  string
+}
+
+func (i *fakeInstrument) Observe(_ context.Context, x float64, attrs ...attribute.KeyValue) {
+	key := i.name
+
+	for _, a := range attrs {
+		key += "," + string(a.Key) + "=" + a.Value.AsString()
+	}
+
+	i.meter.observed[key] = append(i.meter.observed[key], x)
+}
+
+func (i *fakeInstrument) Counter(name string, _ ...instrument.Option) (asyncfloat64.Counter, error) {
+	i.meter.kinds[name] = TypeCounter
+
+	return &fakeInstrument{meter: i.meter, name: name}, nil
+}
+
+func (i *fakeInstrument) UpDownCounter(name string, _ ...instrument.Option) (asyncfloat64.UpDownCounter, error) {
+	return &fakeInstrument{meter: i.meter, name: name}, nil
+}
+
+func (i *fakeInstrument) Gauge(name string, _ ...instrument.Option) (asyncfloat64.Gauge, error) {
+	i.meter.kinds[name] = TypeGauge
+
+	return &fakeInstrument{meter: i.meter, name: name}, nil
+}
+
+// Provides the fake meter.
+type fakeMeterProvider struct {
+	meter *fakeMeter
+}
+
+func (p fakeMeterProvider) Meter(string, ...otelmetric.MeterOption) otelmetric.Meter {
+	return p.meter
+}
+
+func (m *fakeMeter) AsyncFloat64() asyncfloat64.InstrumentProvider {
+	return &fakeInstrument{meter: m}
+}
+
+func (m *fakeMeter) RegisterCallback(_ []instrument.Asynchronous, f func(context.Context)) error {
+	m.callbacks = append(m.callbacks, f)
+
+	return nil
+}
+
+// Runs callbacks, returning the observed values. Each sample must be observed
+// once per collection.
+func (m *fakeMeter) collect(t *testing.T) map[string]float64 {
+	t.Helper()
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.observed = map[string][]float64{}
+
+	for _, f := range m.callbacks {
+		f(context.Background())
+	}
+
+	observed := map[string]float64{}
+
+	for key, values := range m.observed {
+		if len(values) != 1 {
+			t.Fatalf("Expected %s to be observed once, got %v", key, values)
+		}
+
+		observed[key] = values[0]
+	}
+
+	return observed
+}
+
+func TestOTelBridge(t *testing.T) {
+	r := NewRegistry()
+
+	requests := new(CounterVec).Init("method")
+	temperature := new(Float)
+	latency := new(Histogram).Init(1)
+
+	for name, v := range map[string]Var{
+		"requests_total": requests,
+		"temperature":    temperature,
+		"latency":        latency,
+	} {
+		if err := r.Publish(name, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requests.Add(3, "GET")
+	temperature.Set(21.5)
+	latency.Observe(0.5)
+
+	meter := &fakeMeter{kinds: map[string]string{}}
+
+	b, err := NewOTelBridge(fakeMeterProvider{meter}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, kind := range map[string]string{
+		"requests_total": TypeCounter,
+		"temperature":    TypeGauge,
+		"latency_bucket": TypeCounter,
+		"latency_count":  TypeCounter,
+	} {
+		if meter.kinds[name] != kind {
+			t.Errorf("Expected %s to be a %s, got %q", name, kind, meter.kinds[name])
+		}
+	}
+
+	requests.Add(1, "GET")
+
+	observed := meter.collect(t)
+
+	for key, value := range map[string]float64{
+		"requests_total,method=GET": 4,
+		"temperature":               21.5,
+		"latency_bucket,le=1":       1,
+		"latency_sum":               0.5,
+	} {
+		if observed[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, observed[key])
+		}
+	}
+
+	// Published after the bridge was created.
+	jobs := new(Int)
+	jobs.Set(7)
+
+	if err := r.Publish("jobs", jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := meter.collect(t)["jobs"]; ok {
+		t.Fatal("Expected jobs not to be observed before refreshing")
+	}
+
+	if err := b.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := meter.collect(t)["jobs"]; got != 7 {
+		t.Fatalf("Expected jobs to be 7, got %v", got)
+	}
+
+	// Refreshing again doesn't observe twice.
+	if err := b.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := meter.collect(t)["requests_total,method=GET"]; got != 4 {
+		t.Fatalf("Expected requests to be 4, got %v", got)
+	}
+}
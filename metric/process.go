@@ -0,0 +1,34 @@
+package metric
+
+import "time"
+
+// ProcessCollector collects process metrics (e.g.: RSS, open FDs, CPU time,
+// and threads). Samples are reused within the sampling interval. It satisfies
+// the Var, and Collector interfaces.
+//
+// NOTE: Only supported on Linux (via `/proc/self`), on other systems, it
+// collects nothing.
+type ProcessCollector struct {
+	sampler
+}
+
+func (c *ProcessCollector) String() string {
+	return familiesJSON(c.sample("process"))
+}
+
+// Collect satisfies the Collector interface.
+func (c *ProcessCollector) Collect(name string) []Family {
+	return c.sample(name)
+}
+
+// NewProcessCollector is the ProcessCollector factory. Samples are reused
+// within `interval`, if `0`, `DefaultSamplingInterval` is used.
+func NewProcessCollector(interval time.Duration) *ProcessCollector {
+	if interval <= 0 {
+		interval = DefaultSamplingInterval
+	}
+
+	return &ProcessCollector{
+		sampler: sampler{collect: readProcess, interval: interval},
+	}
+}
@@ -0,0 +1,126 @@
+//go:build linux
+
+package metric
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Clock ticks per second of `/proc/self/stat` CPU times, `USER_HZ`, as in
+// `sysconf(_SC_CLK_TCK)`. It's assumed, as reading it requires cgo. The kernel
+// ABI fixes it at 100 on all mainstream architectures, on others, CPU time is
+// off by their ratio.
+const clockTicks = 100
+
+// Returns a family with a single sample.
+func single(name, help, typ string, value float64) Family {
+	return Family{
+		Help:    help,
+		Name:    name,
+		Samples: []Sample{{Name: name, Value: value}},
+		Type:    typ,
+	}
+}
+
+// Reads the boot time, in seconds since the epoch.
+func bootTime() (float64, bool) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, false
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "btime" {
+			v, err := strconv.ParseFloat(fields[1], 64)
+
+			return v, err == nil
+		}
+	}
+
+	return 0, false
+}
+
+// Reads the max number of open FDs.
+func maxFDs() (float64, bool) {
+	data, err := os.ReadFile("/proc/self/limits")
+	if err != nil {
+		return 0, false
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+		if len(fields) == 0 {
+			return 0, false
+		}
+
+		v, err := strconv.ParseFloat(fields[0], 64)
+
+		return v, err == nil
+	}
+
+	return 0, false
+}
+
+// Reads process metrics from `/proc/self`. Unreadable ones are skipped.
+func readProcess(prefix string) []Family {
+	families := []Family{}
+
+	// SEE: https://man7.org/linux/man-pages/man5/proc.5.html
+	if data, err := os.ReadFile("/proc/self/stat"); err == nil {
+		// The command may contain spaces, fields are after its closing `)`.
+		if i := bytes.LastIndexByte(data, ')'); i > 0 && i+2 < len(data) {
+			// Index 0 is the 3rd field (state).
+			fields := strings.Fields(string(data[i+2:]))
+
+			field := func(n int) float64 {
+				if n-3 >= len(fields) {
+					return 0
+				}
+
+				v, _ := strconv.ParseFloat(fields[n-3], 64)
+
+				return v
+			}
+
+			utime, stime := field(14), field(15)
+
+			families = append(families,
+				single(prefix+"_cpu_seconds_total", "Total user, and system CPU time spent in seconds.", TypeCounter, (utime+stime)/clockTicks),
+				single(prefix+"_resident_memory_bytes", "Resident memory size in bytes.", TypeGauge, field(24)*float64(os.Getpagesize())),
+				single(prefix+"_threads", "Number of OS threads.", TypeGauge, field(20)),
+				single(prefix+"_virtual_memory_bytes", "Virtual memory size in bytes.", TypeGauge, field(23)),
+			)
+
+			if boot, ok := bootTime(); ok {
+				families = append(families, single(
+					prefix+"_start_time_seconds",
+					"Start time of the process since unix epoch in seconds.",
+					TypeGauge,
+					boot+field(22)/clockTicks,
+				))
+			}
+		}
+	}
+
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		families = append(families, single(prefix+"_open_fds", "Number of open file descriptors.", TypeGauge, float64(len(entries))))
+	}
+
+	if v, ok := maxFDs(); ok {
+		families = append(families, single(prefix+"_max_fds", "Maximum number of open file descriptors.", TypeGauge, v))
+	}
+
+	return families
+}
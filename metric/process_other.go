@@ -0,0 +1,8 @@
+//go:build !linux
+
+package metric
+
+// Process metrics aren't supported.
+func readProcess(prefix string) []Family {
+	return []Family{}
+}
@@ -0,0 +1,435 @@
+package metric
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//////
+// Consts, and vars.
+//////
+
+// Prometheus metric types.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+	TypeUntyped   = "untyped"
+)
+
+const (
+	// Label added to the samples of `Map` entries.
+	mapKeyLabel = "key"
+
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	prometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+//////
+// Definitions.
+//////
+
+// Label is a Prometheus label.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single Prometheus value.
+type Sample struct {
+	// Labels of the sample, if any.
+	Labels []Label
+
+	// Name of the sample, e.g.: `latency_bucket`, for histograms, and summaries
+	// it differs from the family name.
+	Name string
+
+	// Value of the sample.
+	Value float64
+}
+
+// Family is a group of samples of the same metric.
+type Family struct {
+	// Help describes the metric.
+	Help string
+
+	// Name of the metric.
+	Name string
+
+	// Samples of the metric.
+	Samples []Sample
+
+	// Type of the metric, e.g.: `TypeCounter`.
+	Type string
+}
+
+// Determines if `s`, a sample of `f`, only increases, e.g.: counters, and
+// histograms buckets, sums, and counts.
+func (f Family) isCumulative(s Sample) bool {
+	switch f.Type {
+	case TypeCounter:
+		return true
+	case TypeHistogram, TypeSummary:
+		return s.Name != f.Name
+	default:
+		return false
+	}
+}
+
+// Collector is a `Var` which knows how to render itself in the Prometheus
+// format. Vars which aren't collectors are rendered from their JSON.
+type Collector interface {
+	Var
+
+	// Collect returns the families of the variable published as `name`.
+	Collect(name string) []Family
+}
+
+//////
+// Helpers.
+//////
+
+// SanitizeName converts `name` into a valid Prometheus metric name, e.g.:
+// `HeapAlloc` becomes `heap_alloc`, and `http.requests` becomes
+// `http_requests`.
+func SanitizeName(name string) string {
+	runes := []rune(name)
+
+	var b strings.Builder
+
+	for i, r := range runes {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsUpper(r):
+			// Word boundary, e.g.: `heapAlloc`, or `GCCPUFraction`.
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1]))) {
+				b.WriteRune('_')
+			}
+
+			b.WriteRune(unicode.ToLower(r))
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == ':'):
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	s := b.String()
+
+	if s == "" || unicode.IsDigit(rune(s[0])) {
+		s = "_" + s
+	}
+
+	return s
+}
+
+// Sanitizes a label name - same as metric names, but `:` isn't allowed.
+func sanitizeLabelName(name string) string {
+	return strings.ReplaceAll(SanitizeName(name), ":", "_")
+}
+
+// Returns a copy of `labels` plus `name`="`value`". If `name` is taken, a
+// numeric suffix is added.
+func withLabel(labels []Label, name, value string) []Label {
+	taken := func(n string) bool {
+		for _, l := range labels {
+			if l.Name == n {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	labelName := name
+
+	for i := 2; taken(labelName); i++ {
+		labelName = name + strconv.Itoa(i)
+	}
+
+	return append(append(make([]Label, 0, len(labels)+1), labels...), Label{Name: labelName, Value: value})
+}
+
+// Flattens a decoded JSON value into families. Object fields are appended to
+// the name, numbers, and booleans become samples, everything else is skipped.
+func flattenJSON(name string, v interface{}, families map[string]*Family) {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(vv))
+
+		for k := range vv {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			flattenJSON(name+"_"+SanitizeName(k), vv[k], families)
+		}
+	case json.Number:
+		f, err := vv.Float64()
+		if err != nil {
+			return
+		}
+
+		addSample(families, name, TypeUntyped, Sample{Name: name, Value: f})
+	case bool:
+		f := 0.0
+
+		if vv {
+			f = 1
+		}
+
+		addSample(families, name, TypeGauge, Sample{Name: name, Value: f})
+	}
+}
+
+// Adds `sample` to the `name` family, creating it if needed.
+func addSample(families map[string]*Family, name, typ string, sample Sample) {
+	f, ok := families[name]
+	if !ok {
+		f = &Family{Name: name, Type: typ}
+
+		families[name] = f
+	}
+
+	f.Samples = append(f.Samples, sample)
+}
+
+// Collects the families of `v` published as `name`.
+func collect(name string, v Var) []Family {
+	name = SanitizeName(name)
+
+	switch vv := v.(type) {
+	case Collector:
+		return vv.Collect(name)
+	case *Int:
+		return []Family{{
+			Name:    name,
+			Samples: []Sample{{Name: name, Value: float64(vv.Value())}},
+			Type:    TypeUntyped,
+		}}
+	case *Float:
+		return []Family{{
+			Name:    name,
+			Samples: []Sample{{Name: name, Value: vv.Value()}},
+			Type:    TypeUntyped,
+		}}
+	case *String:
+		return nil
+	case *Map:
+		families := map[string]*Family{}
+		order := []string{}
+
+		// Keys become labels of the entries samples.
+		vv.Do(func(kv KeyValue) {
+			for _, f := range collect(name, kv.Value) {
+				existing, ok := families[f.Name]
+				if !ok {
+					existing = &Family{Help: f.Help, Name: f.Name, Type: f.Type}
+
+					families[f.Name] = existing
+
+					order = append(order, f.Name)
+				}
+
+				for _, s := range f.Samples {
+					s.Labels = withLabel(s.Labels, mapKeyLabel, kv.Key)
+
+					existing.Samples = append(existing.Samples, s)
+				}
+			}
+		})
+
+		result := make([]Family, 0, len(order))
+
+		for _, n := range order {
+			result = append(result, *families[n])
+		}
+
+		return result
+	default:
+		decoder := json.NewDecoder(strings.NewReader(v.String()))
+		decoder.UseNumber()
+
+		var decoded interface{}
+
+		if err := decoder.Decode(&decoded); err != nil {
+			return nil
+		}
+
+		families := map[string]*Family{}
+
+		flattenJSON(name, decoded, families)
+
+		result := make([]Family, 0, len(families))
+
+		for _, f := range families {
+			result = append(result, *f)
+		}
+
+		return result
+	}
+}
+
+// Gathers the families of all variables iterated by `do`, sorted by name.
+// Families with the same name are merged, unless their types differ, then the
+// latter is skipped - one family can't have mixed samples.
+func gather(do func(func(KeyValue))) []Family {
+	families := map[string]*Family{}
+
+	do(func(kv KeyValue) {
+		for _, f := range collect(kv.Key, kv.Value) {
+			f := f
+
+			if existing, ok := families[f.Name]; ok {
+				if existing.Type == f.Type {
+					existing.Samples = append(existing.Samples, f.Samples...)
+				}
+
+				continue
+			}
+
+			if f.Help == "" {
+				f.Help = fmt.Sprintf("Published metric %s.", kv.Key)
+			}
+
+			families[f.Name] = &f
+		}
+	})
+
+	result := make([]Family, 0, len(families))
+
+	for _, f := range families {
+		result = append(result, *f)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// Formats `v` as a Prometheus value.
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// Escapes label values.
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Escapes help texts.
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// WritePrometheus writes `families` in the Prometheus text format, or in the
+// OpenMetrics one.
+func WritePrometheus(w io.Writer, families []Family, openMetrics bool) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range families {
+		name, typ := f.Name, f.Type
+
+		// OpenMetrics counters families don't have the suffix, but their
+		// samples do.
+		counterOM := openMetrics && typ == TypeCounter
+
+		if openMetrics {
+			if counterOM {
+				name = strings.TrimSuffix(name, "_total")
+			}
+
+			if typ == TypeUntyped {
+				typ = "unknown"
+			}
+		}
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, helpReplacer.Replace(f.Help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, typ)
+
+		for _, s := range f.Samples {
+			sampleName := s.Name
+
+			if counterOM && (sampleName == f.Name || sampleName == name) {
+				sampleName = name + "_total"
+			}
+
+			bw.WriteString(sampleName)
+
+			if len(s.Labels) > 0 {
+				bw.WriteByte('{')
+
+				for i, l := range s.Labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+
+					fmt.Fprintf(bw, `%s="%s"`, sanitizeLabelName(l.Name), labelValueReplacer.Replace(l.Value))
+				}
+
+				bw.WriteByte('}')
+			}
+
+			fmt.Fprintf(bw, " %s\n", formatValue(s.Value))
+		}
+	}
+
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+
+	return bw.Flush()
+}
+
+// Renders the variables iterated by `do`, negotiating the format.
+func servePrometheus(w http.ResponseWriter, r *http.Request, do func(func(KeyValue))) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+
+	var buf bytes.Buffer
+
+	if err := WritePrometheus(&buf, gather(do), openMetrics); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", prometheusContentType)
+	}
+
+	_, _ = buf.WriteTo(w)
+}
+
+//////
+// Handler.
+//////
+
+// PrometheusHandler returns the HTTP Handler serving all published variables
+// in the Prometheus text format - or OpenMetrics, if the client asks for it.
+// `Map` keys become labels, and numeric fields of `Func` become metrics.
+func PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		servePrometheus(w, r, Do)
+	})
+}
@@ -0,0 +1,162 @@
+package metric
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "HeapAlloc", want: "heap_alloc"},
+		{name: "GCCPUFraction", want: "gccpu_fraction"},
+		{name: "NumGC", want: "num_gc"},
+		{name: "http.requests-total", want: "http_requests_total"},
+		{name: "9lives", want: "_9lives"},
+		{name: "already_valid:name", want: "already_valid:name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeName(tt.name); got != tt.want {
+				t.Errorf("SanitizeName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	requests := new(Int)
+	requests.Set(42)
+
+	ratio := new(Float)
+	ratio.Set(0.5)
+
+	version := new(String)
+	version.Set("v1.0.0")
+
+	byCode := new(Map).Init()
+	byCode.Add("200", 3)
+	byCode.Add(`5"x"`, 1)
+
+	server := Func(func() interface{} {
+		return struct {
+			Name      string
+			PID       int
+			HeapAlloc uint64
+			Enabled   bool
+			Tags      []string
+		}{"api", 7, 1024, true, []string{"a"}}
+	})
+
+	vars := []KeyValue{
+		{Key: "requests", Value: requests},
+		{Key: "ratio", Value: ratio},
+		{Key: "version", Value: version},
+		{Key: "by_code", Value: byCode},
+		{Key: "server", Value: server},
+	}
+
+	do := func(f func(KeyValue)) {
+		for _, kv := range vars {
+			f(kv)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := WritePrometheus(&buf, gather(do), false); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP by_code Published metric by_code.
+# TYPE by_code untyped
+by_code{key="200"} 3
+by_code{key="5\"x\""} 1
+# HELP ratio Published metric ratio.
+# TYPE ratio untyped
+ratio 0.5
+# HELP requests Published metric requests.
+# TYPE requests untyped
+requests 42
+# HELP server_enabled Published metric server.
+# TYPE server_enabled gauge
+server_enabled 1
+# HELP server_heap_alloc Published metric server.
+# TYPE server_heap_alloc untyped
+server_heap_alloc 1024
+# HELP server_pid Published metric server.
+# TYPE server_pid untyped
+server_pid 7
+`
+
+	if got := buf.String(); got != want {
+		t.Fatalf("WritePrometheus() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrometheusHandler_openMetrics(t *testing.T) {
+	counter := []Family{
+		{
+			Help:    "Total requests.",
+			Name:    "requests_total",
+			Samples: []Sample{{Name: "requests_total", Value: 1}},
+			Type:    TypeCounter,
+		},
+		{
+			Help:    "Total jobs.",
+			Name:    "jobs",
+			Samples: []Sample{{Name: "jobs", Value: 2}},
+			Type:    TypeCounter,
+		},
+	}
+
+	var buf bytes.Buffer
+
+	if err := WritePrometheus(&buf, counter, true); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "# HELP requests Total requests.\n# TYPE requests counter\nrequests_total 1\n" +
+		"# HELP jobs Total jobs.\n# TYPE jobs counter\njobs_total 2\n# EOF\n"
+
+	if got := buf.String(); got != want {
+		t.Fatalf("WritePrometheus() = %q, want %q", got, want)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+
+	w := httptest.NewRecorder()
+
+	PrometheusHandler().ServeHTTP(w, r)
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Fatalf("Expected OpenMetrics content type, got %q", ct)
+	}
+
+	if !strings.HasSuffix(w.Body.String(), "# EOF\n") {
+		t.Fatalf("Expected OpenMetrics terminator, got %q", w.Body.String())
+	}
+}
+
+func Test_gather_mismatchedTypes(t *testing.T) {
+	counter := new(CounterVec).Init("method")
+	counter.Add(1, "GET")
+
+	gauge := new(Float)
+	gauge.Set(2)
+
+	families := gather(func(f func(KeyValue)) {
+		f(KeyValue{Key: "jobs", Value: counter})
+		f(KeyValue{Key: "jobs", Value: gauge})
+	})
+
+	if len(families) != 1 || len(families[0].Samples) != 1 {
+		t.Fatalf("Expected one family with one sample, got %+v", families)
+	}
+}
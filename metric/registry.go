@@ -0,0 +1,207 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Consts, and vars.
+//////
+
+var (
+	// ErrAlreadyPublished indicates a variable with the same name is already
+	// published.
+	ErrAlreadyPublished = errors.New("already published")
+
+	// ErrNotPublished indicates there's no variable with the name.
+	ErrNotPublished = errors.New("not published")
+)
+
+// Package-level registry, used by `Publish`, `Get`, `Do`, and `Handler`.
+var defaultRegistry = NewRegistry()
+
+//////
+// Registry type.
+//////
+
+// Registry is a set of named variables. Servers own one, so multiple servers
+// can publish variables with the same name. It's safe for concurrent use.
+type Registry struct {
+	vars   sync.Map // map[string]Var
+	keysMu sync.RWMutex
+	keys   []string // sorted
+}
+
+// Validates `name`, and `v`.
+func validateVar(name string, v Var) error {
+	if name == "" {
+		return customerror.NewRequiredError("metric name")
+	}
+
+	if v == nil {
+		return customerror.NewRequiredError(fmt.Sprintf("metric %s value", name))
+	}
+
+	return nil
+}
+
+// Inserts `name` in the sorted list of keys. Callers must hold `keysMu`.
+func (r *Registry) insertKey(name string) {
+	if i := sort.SearchStrings(r.keys, name); i >= len(r.keys) {
+		r.keys = append(r.keys, name)
+	} else if r.keys[i] != name {
+		r.keys = append(r.keys, "")
+		copy(r.keys[i+1:], r.keys[i:])
+		r.keys[i] = name
+	}
+}
+
+// Publish declares a named variable. It errors if the name is already
+// published.
+func (r *Registry) Publish(name string, v Var) error {
+	if err := validateVar(name, v); err != nil {
+		return err
+	}
+
+	r.keysMu.Lock()
+	defer r.keysMu.Unlock()
+
+	if _, dup := r.vars.Load(name); dup {
+		return customerror.NewFailedToError(fmt.Sprintf("publish %s", name), customerror.WithError(ErrAlreadyPublished))
+	}
+
+	r.vars.Store(name, v)
+
+	r.insertKey(name)
+
+	return nil
+}
+
+// Replace publishes `v` as `name`, replacing the existing variable, if any.
+func (r *Registry) Replace(name string, v Var) error {
+	if err := validateVar(name, v); err != nil {
+		return err
+	}
+
+	r.keysMu.Lock()
+	defer r.keysMu.Unlock()
+
+	_, existed := r.vars.Load(name)
+
+	r.vars.Store(name, v)
+
+	if !existed {
+		r.insertKey(name)
+	}
+
+	return nil
+}
+
+// Unpublish removes a named variable. It errors if the name isn't published.
+func (r *Registry) Unpublish(name string) error {
+	r.keysMu.Lock()
+	defer r.keysMu.Unlock()
+
+	i := sort.SearchStrings(r.keys, name)
+	if i >= len(r.keys) || r.keys[i] != name {
+		return customerror.NewFailedToError(fmt.Sprintf("unpublish %s", name), customerror.WithError(ErrNotPublished))
+	}
+
+	r.keys = append(r.keys[:i], r.keys[i+1:]...)
+	r.vars.Delete(name)
+
+	return nil
+}
+
+// Get retrieves a named variable. It returns nil if the name isn't
+// published.
+func (r *Registry) Get(name string) Var {
+	i, _ := r.vars.Load(name)
+	v, _ := i.(Var)
+	return v
+}
+
+// Do calls f for each variable, sorted by name. The registry is locked during
+// the iteration, but existing entries may be concurrently updated.
+func (r *Registry) Do(f func(KeyValue)) {
+	r.keysMu.RLock()
+	defer r.keysMu.RUnlock()
+
+	for _, k := range r.keys {
+		val, ok := r.vars.Load(k)
+		if !ok {
+			continue
+		}
+
+		f(KeyValue{k, val.(Var)})
+	}
+}
+
+//////
+// Helpers.
+//////
+
+// Iterates over all variables of `registries`. If a name is published in
+// more than one, the first registry wins.
+func doAll(registries []*Registry) func(func(KeyValue)) {
+	return func(f func(KeyValue)) {
+		seen := map[string]bool{}
+
+		for _, r := range registries {
+			r.Do(func(kv KeyValue) {
+				if seen[kv.Key] {
+					return
+				}
+
+				seen[kv.Key] = true
+
+				f(kv)
+			})
+		}
+	}
+}
+
+//////
+// Handlers.
+//////
+
+// HandlerFor returns the HTTP Handler serving the variables of `registries`
+// as JSON. If a name is published in more than one, the first registry wins.
+func HandlerFor(registries ...*Registry) http.Handler {
+	do := doAll(registries)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, do)
+	})
+}
+
+// PrometheusHandlerFor returns the HTTP Handler serving the variables of
+// `registries` in the Prometheus text format. If a name is published in more
+// than one, the first registry wins.
+func PrometheusHandlerFor(registries ...*Registry) http.Handler {
+	do := doAll(registries)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		servePrometheus(w, r, do)
+	})
+}
+
+//////
+// Factory.
+//////
+
+// Default returns the package-level registry.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// NewRegistry is the Registry factory.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
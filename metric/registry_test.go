@@ -0,0 +1,87 @@
+package metric
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	counter := new(Int)
+	counter.Set(1)
+
+	if err := r.Publish("counter", counter); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Publish("counter", new(Int)); !errors.Is(err, ErrAlreadyPublished) {
+		t.Fatalf("Expected %v, got %v", ErrAlreadyPublished, err)
+	}
+
+	if err := r.Publish("", new(Int)); err == nil {
+		t.Fatal("Expected error for empty name")
+	}
+
+	replacement := new(Int)
+	replacement.Set(2)
+
+	if err := r.Replace("counter", replacement); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Get("counter") != replacement {
+		t.Fatal("Expected replaced variable")
+	}
+
+	if err := r.Unpublish("counter"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Unpublish("counter"); !errors.Is(err, ErrNotPublished) {
+		t.Fatalf("Expected %v, got %v", ErrNotPublished, err)
+	}
+
+	if r.Get("counter") != nil {
+		t.Fatal("Expected no variable")
+	}
+}
+
+func TestHandlerFor(t *testing.T) {
+	own := NewRegistry()
+	other := NewRegistry()
+
+	ownCounter := new(Int)
+	ownCounter.Set(1)
+
+	otherCounter := new(Int)
+	otherCounter.Set(2)
+
+	for _, err := range []error{
+		own.Publish("counter", ownCounter),
+		other.Publish("counter", otherCounter),
+		other.Publish("other", otherCounter),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+
+	HandlerFor(own, other).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+
+	got := map[string]int{}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// First registry wins.
+	if got["counter"] != 1 || got["other"] != 2 || len(got) != 2 {
+		t.Fatalf("HandlerFor() = %v", got)
+	}
+}
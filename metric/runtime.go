@@ -0,0 +1,275 @@
+package metric
+
+import (
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//////
+// Consts, and vars.
+//////
+
+// DefaultSamplingInterval is for how long collected samples are reused.
+const DefaultSamplingInterval = 5 * time.Second
+
+// Runtime metrics, and their names. Metrics not supported by the running Go
+// version are skipped.
+var runtimeMetrics = map[string]string{
+	"/gc/cycles/total:gc-cycles":         "gc_cycles_total",
+	"/gc/heap/allocs:bytes":              "gc_heap_allocs_bytes_total",
+	"/gc/heap/allocs:objects":            "gc_heap_allocs_objects_total",
+	"/gc/heap/goal:bytes":                "gc_heap_goal_bytes",
+	"/gc/pauses:seconds":                 "gc_pauses_seconds",
+	"/memory/classes/heap/objects:bytes": "memory_heap_objects_bytes",
+	"/memory/classes/total:bytes":        "memory_total_bytes",
+	"/sched/gomaxprocs:threads":          "gomaxprocs",
+	"/sched/goroutines:goroutines":       "goroutines",
+	"/sched/latencies:seconds":           "sched_latencies_seconds",
+}
+
+// Runtime histograms have hundreds of buckets, they are merged into these.
+var runtimeBuckets = []float64{
+	1e-6, 1e-5, 1e-4, 2.5e-4, 5e-4, 1e-3, 2.5e-3, 5e-3, 1e-2, 2.5e-2, 5e-2, .1, .25, .5, 1, 2.5, 5, 10,
+}
+
+//////
+// Sampler.
+//////
+
+// sampler caches collected families for an interval, so frequent scrapes
+// are cheap. Families are cached without prefix, so callers with different
+// ones (e.g.: `String`, and `Collect`) share samples.
+type sampler struct {
+	collect  func(prefix string) []Family
+	cached   []Family
+	interval time.Duration
+	last     time.Time
+	m        sync.Mutex
+}
+
+// Returns the cached families named after `prefix`, collecting them again if
+// stale.
+func (s *sampler) sample(prefix string) []Family {
+	s.m.Lock()
+
+	if s.cached == nil || time.Since(s.last) >= s.interval {
+		s.cached = s.collect("")
+		s.last = time.Now()
+	}
+
+	cached := s.cached
+
+	s.m.Unlock()
+
+	families := make([]Family, len(cached))
+
+	for i, f := range cached {
+		f.Name = prefix + f.Name
+		f.Samples = append([]Sample{}, f.Samples...)
+
+		for j := range f.Samples {
+			f.Samples[j].Name = prefix + f.Samples[j].Name
+		}
+
+		families[i] = f
+	}
+
+	return families
+}
+
+// Renders families as a JSON object. Unlabeled single samples are values,
+// others are objects keyed by the sample name, and labels.
+func familiesJSON(families []Family) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "{")
+
+	for i, f := range families {
+		if i > 0 {
+			fmt.Fprintf(&b, ", ")
+		}
+
+		if len(f.Samples) == 1 && len(f.Samples[0].Labels) == 0 {
+			fmt.Fprintf(&b, "%q: %s", f.Name, jsonFloat(f.Samples[0].Value))
+
+			continue
+		}
+
+		fmt.Fprintf(&b, "%q: {", f.Name)
+
+		for j, s := range f.Samples {
+			if j > 0 {
+				fmt.Fprintf(&b, ", ")
+			}
+
+			labels := make([]string, 0, len(s.Labels))
+
+			for _, l := range s.Labels {
+				labels = append(labels, fmt.Sprintf("%s=%q", l.Name, l.Value))
+			}
+
+			key := s.Name
+
+			if len(labels) > 0 {
+				key += "{" + strings.Join(labels, ",") + "}"
+			}
+
+			fmt.Fprintf(&b, "%q: %s", key, jsonFloat(s.Value))
+		}
+
+		fmt.Fprintf(&b, "}")
+	}
+
+	fmt.Fprintf(&b, "}")
+
+	return b.String()
+}
+
+//////
+// Runtime collector.
+//////
+
+// RuntimeCollector collects Go runtime metrics (e.g.: GC pauses, scheduler
+// latencies, and goroutines) via `runtime/metrics`, which - differently from
+// `runtime.ReadMemStats` - doesn't stop the world. Samples are reused within
+// the sampling interval. It satisfies the Var, and Collector interfaces.
+type RuntimeCollector struct {
+	descriptions map[string]metrics.Description
+	sampler
+}
+
+// Reads the runtime metrics.
+func (c *RuntimeCollector) read(prefix string) []Family {
+	samples := make([]metrics.Sample, 0, len(runtimeMetrics))
+
+	for name := range runtimeMetrics {
+		if _, ok := c.descriptions[name]; ok {
+			samples = append(samples, metrics.Sample{Name: name})
+		}
+	}
+
+	metrics.Read(samples)
+
+	families := make([]Family, 0, len(samples))
+
+	for _, s := range samples {
+		name := prefix + "_" + runtimeMetrics[s.Name]
+		description := c.descriptions[s.Name]
+
+		f := Family{Help: description.Description, Name: name, Type: TypeGauge}
+
+		if description.Cumulative {
+			f.Type = TypeCounter
+		}
+
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			f.Samples = []Sample{{Name: name, Value: float64(s.Value.Uint64())}}
+		case metrics.KindFloat64:
+			f.Samples = []Sample{{Name: name, Value: s.Value.Float64()}}
+		case metrics.KindFloat64Histogram:
+			f.Type = TypeHistogram
+			f.Samples = histogramSamples(name, s.Value.Float64Histogram())
+		default:
+			continue
+		}
+
+		families = append(families, f)
+	}
+
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].Name < families[j].Name
+	})
+
+	return families
+}
+
+// Merges a runtime histogram into `runtimeBuckets`. The sum is approximated
+// from the buckets midpoints.
+func histogramSamples(name string, h *metrics.Float64Histogram) []Sample {
+	cumulative := make([]uint64, len(runtimeBuckets))
+
+	var count uint64
+
+	sum := 0.0
+
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+
+		lower, upper := h.Buckets[i], h.Buckets[i+1]
+
+		count += n
+
+		switch {
+		case math.IsInf(lower, -1):
+			sum += upper * float64(n)
+		case math.IsInf(upper, 1):
+			sum += lower * float64(n)
+		default:
+			sum += (lower + upper) / 2 * float64(n)
+		}
+
+		// Counted in every bucket which bound is >= the runtime one.
+		for j, bound := range runtimeBuckets {
+			if upper <= bound {
+				cumulative[j] += n
+			}
+		}
+	}
+
+	samples := make([]Sample, 0, len(runtimeBuckets)+3)
+
+	for j, bound := range runtimeBuckets {
+		samples = append(samples, Sample{
+			Labels: []Label{{Name: "le", Value: formatValue(bound)}},
+			Name:   name + "_bucket",
+			Value:  float64(cumulative[j]),
+		})
+	}
+
+	return append(samples,
+		Sample{Labels: []Label{{Name: "le", Value: "+Inf"}}, Name: name + "_bucket", Value: float64(count)},
+		Sample{Name: name + "_sum", Value: sum},
+		Sample{Name: name + "_count", Value: float64(count)},
+	)
+}
+
+func (c *RuntimeCollector) String() string {
+	return familiesJSON(c.sample("go"))
+}
+
+// Collect satisfies the Collector interface.
+func (c *RuntimeCollector) Collect(name string) []Family {
+	return c.sample(name)
+}
+
+//////
+// Factory.
+//////
+
+// NewRuntimeCollector is the RuntimeCollector factory. Samples are reused
+// within `interval`, if `0`, `DefaultSamplingInterval` is used.
+func NewRuntimeCollector(interval time.Duration) *RuntimeCollector {
+	if interval <= 0 {
+		interval = DefaultSamplingInterval
+	}
+
+	c := &RuntimeCollector{descriptions: map[string]metrics.Description{}}
+
+	for _, d := range metrics.All() {
+		if _, ok := runtimeMetrics[d.Name]; ok {
+			c.descriptions[d.Name] = d
+		}
+	}
+
+	c.sampler = sampler{collect: c.read, interval: interval}
+
+	return c
+}
@@ -0,0 +1,130 @@
+package metric
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRuntimeCollector(t *testing.T) {
+	c := NewRuntimeCollector(time.Hour)
+
+	runtime.GC()
+
+	families := c.Collect("go")
+
+	byName := map[string]Family{}
+
+	for _, f := range families {
+		byName[f.Name] = f
+	}
+
+	goroutines, ok := byName["go_goroutines"]
+	if !ok || goroutines.Type != TypeGauge || goroutines.Samples[0].Value < 1 {
+		t.Fatalf("Expected goroutines gauge, got %+v", goroutines)
+	}
+
+	if f, ok := byName["go_gc_cycles_total"]; !ok || f.Type != TypeCounter {
+		t.Fatalf("Expected GC cycles counter, got %+v", f)
+	}
+
+	if f, ok := byName["go_sched_latencies_seconds"]; !ok || f.Type != TypeHistogram {
+		t.Fatalf("Expected scheduler latencies histogram, got %+v", f)
+	}
+
+	// Sampled, so it doesn't change within the interval.
+	runtime.GC()
+
+	if again := c.Collect("go"); !samplesEqual(again, families) {
+		t.Fatal("Expected cached samples")
+	}
+
+	// Other prefixes share the cache.
+	renamed := c.Collect("runtime")
+
+	for i := range renamed {
+		renamed[i].Name = "go" + strings.TrimPrefix(renamed[i].Name, "runtime")
+	}
+
+	if !samplesEqual(renamed, families) {
+		t.Fatal("Expected cached samples for other prefixes")
+	}
+
+	if !json.Valid([]byte(c.String())) {
+		t.Fatalf("String() isn't valid JSON: %s", c.String())
+	}
+
+	var buf bytes.Buffer
+
+	if err := WritePrometheus(&buf, families, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), `go_sched_latencies_seconds_bucket{le="+Inf"}`) {
+		t.Fatalf("Expected histogram buckets in:\n%s", buf.String())
+	}
+}
+
+func TestProcessCollector(t *testing.T) {
+	c := NewProcessCollector(0)
+
+	families := c.Collect("process")
+
+	if runtime.GOOS != "linux" {
+		if len(families) != 0 {
+			t.Fatalf("Expected no families, got %+v", families)
+		}
+
+		return
+	}
+
+	byName := map[string]Family{}
+
+	for _, f := range families {
+		byName[f.Name] = f
+	}
+
+	for _, name := range []string{
+		"process_cpu_seconds_total",
+		"process_open_fds",
+		"process_resident_memory_bytes",
+		"process_threads",
+	} {
+		f, ok := byName[name]
+		if !ok {
+			t.Fatalf("Expected %s, got %+v", name, families)
+		}
+
+		if name != "process_cpu_seconds_total" && f.Samples[0].Value <= 0 {
+			t.Fatalf("Expected %s to be positive, got %v", name, f.Samples[0].Value)
+		}
+	}
+
+	if !json.Valid([]byte(c.String())) {
+		t.Fatalf("String() isn't valid JSON: %s", c.String())
+	}
+}
+
+// Determines if both have the same samples.
+func samplesEqual(a, b []Family) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Name != b[i].Name || len(a[i].Samples) != len(b[i].Samples) {
+			return false
+		}
+
+		for j := range a[i].Samples {
+			if a[i].Samples[j].Value != b[i].Samples[j].Value {
+				return false
+			}
+		}
+	}
+
+	return true
+}
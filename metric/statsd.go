@@ -0,0 +1,350 @@
+package metric
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Consts, and vars.
+//////
+
+// StatsDFormat is the wire format of the StatsD exporter.
+type StatsDFormat string
+
+const (
+	// StatsD is the Etsy StatsD format. Labels are appended to the name.
+	// Negative gauges are preceded by a reset to 0, as signed ones are
+	// relative changes.
+	StatsD StatsDFormat = "statsd"
+
+	// DogStatsD is the Datadog StatsD format. Labels are sent as tags.
+	DogStatsD StatsDFormat = "dogstatsd"
+)
+
+const (
+	// DefaultStatsDInterval is the default flush interval.
+	DefaultStatsDInterval = 10 * time.Second
+
+	// Max UDP payload, safe for most networks (MTU 1500).
+	statsdMaxPacketSize = 1432
+)
+
+// Escapes characters with meaning in the StatsD format.
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", " ", "_", "\n", "_")
+
+//////
+// Definitions.
+//////
+
+// StatsDOption allows to specify options.
+type StatsDOption func(e *StatsDExporter)
+
+// WithStatsDFormat sets the wire format, default: `StatsD`.
+func WithStatsDFormat(format StatsDFormat) StatsDOption {
+	return func(e *StatsDExporter) {
+		e.format = format
+	}
+}
+
+// WithStatsDInterval sets the flush interval, default: 10s.
+func WithStatsDInterval(interval time.Duration) StatsDOption {
+	return func(e *StatsDExporter) {
+		e.interval = interval
+	}
+}
+
+// WithStatsDPrefix sets the prefix of all metric names, e.g.: `myapp`.
+func WithStatsDPrefix(prefix string) StatsDOption {
+	return func(e *StatsDExporter) {
+		e.prefix = prefix
+	}
+}
+
+// WithStatsDRegistries sets the registries to export. If a name is published
+// in more than one, the first registry wins, default: the package-level
+// registry.
+func WithStatsDRegistries(registries ...*Registry) StatsDOption {
+	return func(e *StatsDExporter) {
+		e.registries = registries
+	}
+}
+
+// WithStatsDTags sets tags added to all metrics, e.g.: `env:prod`.
+//
+// NOTE: Only sent in the `DogStatsD` format.
+func WithStatsDTags(tags ...string) StatsDOption {
+	return func(e *StatsDExporter) {
+		e.tags = tags
+	}
+}
+
+// StatsDExporter periodically pushes published metrics over UDP. Counters,
+// histograms buckets, sums, and counts are sent as counters (deltas since
+// the last flush), everything else as gauges.
+//
+// NOTE: Histograms, and summaries are aggregated in-process, observations
+// aren't kept, so they can't be sent as StatsD timers, histograms, or
+// distributions (`|ms`, `|h`, `|d`). Aggregate their `_bucket` (per `le`),
+// `_sum`, and `_count` counters instead, e.g.: `_sum / _count` for the mean.
+type StatsDExporter struct {
+	address    string
+	conn       net.Conn
+	format     StatsDFormat
+	interval   time.Duration
+	m          sync.Mutex
+	prefix     string
+	previous   map[string]float64
+	registries []*Registry
+	tags       []string
+}
+
+// Formats a metric line.
+func (e *StatsDExporter) line(name string, labels []Label, value float64, typ string) string {
+	var b strings.Builder
+
+	if e.prefix != "" {
+		b.WriteString(e.prefix)
+		b.WriteByte('.')
+	}
+
+	b.WriteString(statsdReplacer.Replace(name))
+
+	tags := append([]string{}, e.tags...)
+
+	for _, l := range labels {
+		if e.format == DogStatsD {
+			tags = append(tags, statsdReplacer.Replace(l.Name)+":"+statsdReplacer.Replace(l.Value))
+
+			continue
+		}
+
+		fmt.Fprintf(&b, ".%s.%s", statsdReplacer.Replace(l.Name), statsdNameSegment(l.Value))
+	}
+
+	fmt.Fprintf(&b, ":%s|%s", strconv.FormatFloat(value, 'f', -1, 64), typ)
+
+	if e.format == DogStatsD && len(tags) > 0 {
+		fmt.Fprintf(&b, "|#%s", strings.Join(tags, ","))
+	}
+
+	return b.String()
+}
+
+// Returns the increase of a counter since the last flush. Resets (e.g.:
+// restarts) send the current value.
+func (e *StatsDExporter) delta(name string, labels []Label, value float64) float64 {
+	key := name
+
+	for _, l := range labels {
+		key += "\xff" + l.Name + "=" + l.Value
+	}
+
+	previous, ok := e.previous[key]
+
+	e.previous[key] = value
+
+	if !ok || value < previous {
+		return value
+	}
+
+	return value - previous
+}
+
+// Converts families to StatsD lines.
+func (e *StatsDExporter) lines(families []Family) []string {
+	lines := []string{}
+
+	for _, f := range families {
+		for _, s := range f.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+
+			if !f.isCumulative(s) {
+				line := e.line(s.Name, s.Labels, s.Value, "g")
+
+				// Signed gauges are relative changes in the StatsD format, so
+				// negative ones are reset first - in the same packet.
+				if e.format == StatsD && s.Value < 0 {
+					line = e.line(s.Name, s.Labels, 0, "g") + "\n" + line
+				}
+
+				lines = append(lines, line)
+
+				continue
+			}
+
+			if d := e.delta(s.Name, s.Labels, s.Value); d != 0 {
+				lines = append(lines, e.line(s.Name, s.Labels, d, "c"))
+			}
+		}
+	}
+
+	sort.Strings(lines)
+
+	return lines
+}
+
+// Flush sends all metrics. A closed exporter connects again.
+func (e *StatsDExporter) Flush() error {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	if err := e.connectLocked(); err != nil {
+		return err
+	}
+
+	var packet bytes.Buffer
+
+	send := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+
+		defer packet.Reset()
+
+		if _, err := e.conn.Write(packet.Bytes()); err != nil {
+			return customerror.NewFailedToError("send metrics to "+e.address, customerror.WithError(err))
+		}
+
+		return nil
+	}
+
+	for _, line := range e.lines(gather(doAll(e.registries))) {
+		// Lines are newline-separated, packets don't exceed the max size.
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacketSize {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+
+		packet.WriteString(line)
+	}
+
+	return send()
+}
+
+// Run flushes metrics every interval until `ctx` is done. Errors are reported
+// to `onError`, if any.
+func (e *StatsDExporter) Run(ctx context.Context, onError func(err error)) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Both may be ready, done wins.
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err := e.Flush(); err != nil && onError != nil {
+				onError(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close releases the connection. It's safe to call more than once.
+func (e *StatsDExporter) Close() error {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	if e.conn == nil {
+		return nil
+	}
+
+	err := e.conn.Close()
+
+	e.conn = nil
+
+	return err
+}
+
+// Dials the StatsD server, unless connected. It must be called with the lock
+// held.
+func (e *StatsDExporter) connectLocked() error {
+	if e.conn != nil {
+		return nil
+	}
+
+	conn, err := net.Dial("udp", e.address)
+	if err != nil {
+		return customerror.NewFailedToError("dial "+e.address, customerror.WithError(err))
+	}
+
+	e.conn = conn
+
+	return nil
+}
+
+//////
+// Helpers.
+//////
+
+// Returns `s` as a name segment, only letters, digits, `_`, and `-` are kept,
+// e.g.: `+Inf` becomes `_Inf`.
+func statsdNameSegment(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+//////
+// Factory.
+//////
+
+// NewStatsDExporter is the StatsDExporter factory. `address` is the StatsD
+// server UDP address, e.g.: `127.0.0.1:8125`.
+func NewStatsDExporter(address string, opts ...StatsDOption) (*StatsDExporter, error) {
+	e := &StatsDExporter{
+		address:  address,
+		format:   StatsD,
+		interval: DefaultStatsDInterval,
+		previous: map[string]float64{},
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	if len(e.registries) == 0 {
+		e.registries = []*Registry{defaultRegistry}
+	}
+
+	if e.interval <= 0 {
+		e.interval = DefaultStatsDInterval
+	}
+
+	if e.format != StatsD && e.format != DogStatsD {
+		return nil, customerror.NewInvalidError(fmt.Sprintf("StatsD format %s", e.format))
+	}
+
+	if err := e.connectLocked(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
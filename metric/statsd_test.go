@@ -0,0 +1,287 @@
+package metric
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Listens for StatsD packets on a random local UDP port.
+func listenStatsD(t *testing.T) (*net.UDPConn, string) {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, conn.LocalAddr().String()
+}
+
+// Reads lines until no packet arrives for a while.
+func readStatsD(t *testing.T, conn *net.UDPConn) []string {
+	t.Helper()
+
+	buf := make([]byte, 65535)
+	lines := []string{}
+
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := conn.Read(buf)
+		if err != nil {
+			return lines
+		}
+
+		if n > statsdMaxPacketSize {
+			t.Fatalf("Packet size %d exceeds %d", n, statsdMaxPacketSize)
+		}
+
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+}
+
+// Verifies `lines` contains `expected`, and not `unexpected`.
+func assertLines(t *testing.T, lines []string, expected []string, unexpected []string) {
+	t.Helper()
+
+	got := map[string]bool{}
+
+	for _, l := range lines {
+		got[l] = true
+	}
+
+	for _, l := range expected {
+		if !got[l] {
+			t.Errorf("Expected line %q, got %q", l, lines)
+		}
+	}
+
+	for _, l := range unexpected {
+		if got[l] {
+			t.Errorf("Unexpected line %q", l)
+		}
+	}
+}
+
+func TestStatsDExporter(t *testing.T) {
+	newRegistry := func() (*Registry, *CounterVec, *Float, *Histogram) {
+		r := NewRegistry()
+
+		requests := new(CounterVec).Init("method")
+		temperature := new(Float)
+		latency := new(Histogram).Init(1)
+
+		for name, v := range map[string]Var{
+			"requests_total": requests,
+			"temperature":    temperature,
+			"latency":        latency,
+			"name":           new(String),
+		} {
+			if err := r.Publish(name, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return r, requests, temperature, latency
+	}
+
+	t.Run("statsd", func(t *testing.T) {
+		conn, address := listenStatsD(t)
+		r, requests, temperature, latency := newRegistry()
+
+		e, err := NewStatsDExporter(address, WithStatsDPrefix("app"), WithStatsDRegistries(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer e.Close()
+
+		requests.Add(3, "GET")
+		temperature.Set(21.5)
+		latency.Observe(0.5)
+
+		if err := e.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		assertLines(t, readStatsD(t, conn), []string{
+			"app.requests_total.method.GET:3|c",
+			"app.temperature:21.5|g",
+			"app.latency_bucket.le.1:1|c",
+			"app.latency_bucket.le._Inf:1|c",
+			"app.latency_count:1|c",
+			"app.latency_sum:0.5|c",
+		}, nil)
+
+		// Counters are sent as deltas, unchanged ones are skipped.
+		requests.Add(2, "GET")
+
+		if err := e.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		assertLines(t, readStatsD(t, conn), []string{
+			"app.requests_total.method.GET:2|c",
+			"app.temperature:21.5|g",
+		}, []string{
+			"app.latency_count:1|c",
+		})
+
+		// Negative gauges are reset first, otherwise they are decrements.
+		temperature.Set(-3)
+
+		if err := e.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := readStatsD(t, conn)
+
+		for i, l := range lines {
+			if l == "app.temperature:-3|g" && (i == 0 || lines[i-1] != "app.temperature:0|g") {
+				t.Errorf("Expected the gauge to be reset before %q, got %q", l, lines)
+			}
+		}
+
+		assertLines(t, lines, []string{"app.temperature:0|g", "app.temperature:-3|g"}, nil)
+	})
+
+	t.Run("dogstatsd", func(t *testing.T) {
+		conn, address := listenStatsD(t)
+		r, requests, temperature, _ := newRegistry()
+
+		e, err := NewStatsDExporter(address,
+			WithStatsDFormat(DogStatsD),
+			WithStatsDRegistries(r),
+			WithStatsDTags("env:test"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer e.Close()
+
+		requests.Add(1, "POST")
+		temperature.Set(-3)
+
+		if err := e.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Gauges are absolute, even if negative.
+		assertLines(t, readStatsD(t, conn), []string{
+			"requests_total:1|c|#env:test,method:POST",
+			"temperature:-3|g|#env:test",
+		}, []string{
+			"temperature:0|g|#env:test",
+		})
+	})
+
+	t.Run("batching", func(t *testing.T) {
+		conn, address := listenStatsD(t)
+		r := NewRegistry()
+
+		requests := new(CounterVec).Init("path")
+
+		if err := r.Publish("requests_total", requests); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 200; i++ {
+			requests.Add(1, strings.Repeat("x", i%10)+string(rune('a'+i%26))+strings.Repeat("y", i/26))
+		}
+
+		e, err := NewStatsDExporter(address, WithStatsDRegistries(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer e.Close()
+
+		if err := e.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		if lines := readStatsD(t, conn); len(lines) != 200 {
+			t.Fatalf("Expected 200 lines, got %d", len(lines))
+		}
+	})
+
+	t.Run("run", func(t *testing.T) {
+		conn, address := listenStatsD(t)
+		r, requests, _, _ := newRegistry()
+
+		e, err := NewStatsDExporter(address, WithStatsDInterval(10*time.Millisecond), WithStatsDRegistries(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer e.Close()
+
+		requests.Add(1, "GET")
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan struct{})
+
+		go func() {
+			e.Run(ctx, func(err error) { t.Error(err) })
+			close(done)
+		}()
+
+		if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 65535)
+
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cancel()
+		<-done
+
+		assertLines(t, strings.Split(string(buf[:n]), "\n"), []string{"requests_total.method.GET:1|c"}, nil)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		conn, address := listenStatsD(t)
+		r, requests, _, _ := newRegistry()
+
+		e, err := NewStatsDExporter(address, WithStatsDRegistries(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// A closed exporter connects again.
+		requests.Add(1, "GET")
+
+		if err := e.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		defer e.Close()
+
+		assertLines(t, readStatsD(t, conn), []string{"requests_total.method.GET:1|c"}, nil)
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		if _, err := NewStatsDExporter("127.0.0.1:8125", WithStatsDFormat("graphite")); err == nil {
+			t.Fatal("Expected error for invalid format")
+		}
+	})
+}
@@ -0,0 +1,285 @@
+package metric
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//////
+// Consts, and vars.
+//////
+
+const (
+	// Sub-windows of the sliding window. The oldest is dropped as time goes.
+	summaryAgeBuckets = 5
+
+	// Max observations kept per sub-window. Beyond it, observations are
+	// sampled, so memory is bounded under heavy load.
+	summaryMaxSamples = 1024
+)
+
+var (
+	// DefaultQuantiles are the default summary quantiles.
+	DefaultQuantiles = []float64{.5, .9, .99}
+
+	// DefaultWindow is the default summary sliding window.
+	DefaultWindow = 10 * time.Minute
+)
+
+//////
+// Summary type.
+//////
+
+// Sub-window of observations.
+type summaryBucket struct {
+	// Sub-window number since the epoch, identifies stale buckets.
+	epoch int64
+
+	// Sampled observations.
+	samples []float64
+
+	// Number of observations, including not sampled ones.
+	seen int
+}
+
+// Summary calculates quantiles of observations over a sliding window. Count,
+// and sum are over all observations. It satisfies the Var, and Collector
+// interfaces. It's safe for concurrent use. The zero value uses
+// `DefaultWindow`, and `DefaultQuantiles`, `Init` sets others - before use.
+//
+// NOTE: Unlike `Int`, `Float`, and `Histogram`, which are lock-free,
+// observations take a lock. Under heavy contention, prefer `Histogram`.
+type Summary struct {
+	// First, so it's 64-bit aligned for atomic operations.
+	count uint64
+
+	buckets   []summaryBucket
+	m         sync.Mutex
+	now       func() time.Time
+	quantiles []float64
+	random    *rand.Rand
+	sum       Float
+	window    time.Duration
+}
+
+// Init sets the sliding window, and quantiles (between 0, and 1), and resets
+// the summary. If not set, `DefaultWindow`, and `DefaultQuantiles` are used.
+func (s *Summary) Init(window time.Duration, quantiles ...float64) *Summary {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.configure(window, quantiles...)
+
+	s.count = 0
+	s.sum.Set(0)
+
+	return s
+}
+
+// Sets the sliding window, and quantiles, dropping observations in the window.
+// It must be called with the lock held.
+func (s *Summary) configure(window time.Duration, quantiles ...float64) {
+	// Each sub-window must be at least 1ns.
+	if window < summaryAgeBuckets {
+		window = DefaultWindow
+	}
+
+	if len(quantiles) == 0 {
+		quantiles = DefaultQuantiles
+	}
+
+	s.quantiles = append([]float64{}, quantiles...)
+
+	sort.Float64s(s.quantiles)
+
+	s.buckets = make([]summaryBucket, summaryAgeBuckets)
+	s.now = time.Now
+	s.random = rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec
+	s.window = window
+}
+
+// Sets the defaults, unless `Init` was called. It must be called with the lock
+// held.
+func (s *Summary) lazyInitLocked() {
+	if s.buckets == nil {
+		s.configure(DefaultWindow)
+	}
+}
+
+// Observe adds `value` to the summary.
+func (s *Summary) Observe(value float64) {
+	atomic.AddUint64(&s.count, 1)
+
+	s.sum.Add(value)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.lazyInitLocked()
+
+	b := s.current()
+
+	b.seen++
+
+	if len(b.samples) < summaryMaxSamples {
+		b.samples = append(b.samples, value)
+
+		return
+	}
+
+	// Reservoir sampling, every observation has the same chance to be kept.
+	if i := s.random.Intn(b.seen); i < summaryMaxSamples {
+		b.samples[i] = value
+	}
+}
+
+// Count returns the number of observations.
+func (s *Summary) Count() uint64 {
+	return atomic.LoadUint64(&s.count)
+}
+
+// Sum returns the sum of observations.
+func (s *Summary) Sum() float64 {
+	return s.sum.Value()
+}
+
+// Quantiles returns the quantiles, and their values over the sliding window.
+// Values are `NaN` if there are no observations in the window.
+func (s *Summary) Quantiles() ([]float64, []float64) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.lazyInitLocked()
+
+	type weighted struct {
+		value  float64
+		weight float64
+	}
+
+	epoch := s.epoch()
+
+	all := []weighted{}
+	total := 0.0
+
+	for _, b := range s.buckets {
+		if b.epoch <= epoch-summaryAgeBuckets || len(b.samples) == 0 {
+			continue
+		}
+
+		// Sampled observations stand for the not sampled ones.
+		weight := float64(b.seen) / float64(len(b.samples))
+
+		for _, v := range b.samples {
+			all = append(all, weighted{value: v, weight: weight})
+		}
+
+		total += float64(b.seen)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].value < all[j].value
+	})
+
+	values := make([]float64, len(s.quantiles))
+
+	for i, q := range s.quantiles {
+		values[i] = math.NaN()
+
+		cumulative := 0.0
+
+		for _, w := range all {
+			cumulative += w.weight
+
+			if cumulative >= q*total {
+				values[i] = w.value
+
+				break
+			}
+		}
+	}
+
+	return append([]float64{}, s.quantiles...), values
+}
+
+func (s *Summary) String() string {
+	quantiles, values := s.Quantiles()
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `{"count": %d, "quantiles": {`, s.Count())
+
+	for i, q := range quantiles {
+		if i > 0 {
+			fmt.Fprintf(&b, ", ")
+		}
+
+		fmt.Fprintf(&b, "%q: %s", formatValue(q), jsonFloat(values[i]))
+	}
+
+	fmt.Fprintf(&b, `}, "sum": %s}`, jsonFloat(s.Sum()))
+
+	return b.String()
+}
+
+// Collect satisfies the Collector interface.
+func (s *Summary) Collect(name string) []Family {
+	quantiles, values := s.Quantiles()
+
+	samples := make([]Sample, 0, len(quantiles)+2)
+
+	for i, q := range quantiles {
+		samples = append(samples, Sample{
+			Labels: []Label{{Name: "quantile", Value: formatValue(q)}},
+			Name:   name,
+			Value:  values[i],
+		})
+	}
+
+	samples = append(samples,
+		Sample{Name: name + "_sum", Value: s.Sum()},
+		Sample{Name: name + "_count", Value: float64(s.Count())},
+	)
+
+	return []Family{{
+		Name:    name,
+		Samples: samples,
+		Type:    TypeSummary,
+	}}
+}
+
+// Current sub-window number.
+func (s *Summary) epoch() int64 {
+	return s.now().UnixNano() / int64(s.window/summaryAgeBuckets)
+}
+
+// Returns the current sub-window, resetting it if stale.
+func (s *Summary) current() *summaryBucket {
+	epoch := s.epoch()
+
+	b := &s.buckets[epoch%summaryAgeBuckets]
+
+	if b.epoch != epoch {
+		b.epoch = epoch
+		b.samples = b.samples[:0]
+		b.seen = 0
+	}
+
+	return b
+}
+
+//////
+// Factory.
+//////
+
+// NewSummary creates, and publishes a summary.
+func NewSummary(name string, window time.Duration, quantiles ...float64) *Summary {
+	v := new(Summary).Init(window, quantiles...)
+	Publish(name, v)
+	return v
+}
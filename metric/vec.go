@@ -0,0 +1,259 @@
+package metric
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//////
+// Base type.
+//////
+
+// Labeled variable of a vector.
+type vecChild struct {
+	labels []Label
+	v      Var
+}
+
+// vec is a set of variables, one per label values combination.
+type vec struct {
+	labelNames []string
+	m          sync.Map // map[string]*vecChild
+	keysMu     sync.RWMutex
+	keys       []string // sorted
+	newVar     func() Var
+}
+
+// Resets the vector.
+func (v *vec) init(newVar func() Var, labelNames []string) {
+	v.keysMu.Lock()
+	defer v.keysMu.Unlock()
+
+	v.labelNames = append([]string{}, labelNames...)
+	v.newVar = newVar
+	v.keys = v.keys[:0]
+
+	v.m.Range(func(k, _ interface{}) bool {
+		v.m.Delete(k)
+		return true
+	})
+}
+
+// Sets `newVar` if the vector wasn't initialized, e.g.: zero value. Returns
+// the label names, and the variable factory in use.
+func (v *vec) lazyInit(newVar func() Var) ([]string, func() Var) {
+	v.keysMu.Lock()
+	defer v.keysMu.Unlock()
+
+	if v.newVar == nil {
+		v.newVar = newVar
+	}
+
+	return v.labelNames, v.newVar
+}
+
+// Gets, or creates the variable of `values`. Missing values are empty, extra
+// ones are ignored. `zero` creates variables of a vector which wasn't
+// initialized.
+func (v *vec) get(values []string, zero func() Var) Var {
+	v.keysMu.RLock()
+	labelNames, newVar := v.labelNames, v.newVar
+	v.keysMu.RUnlock()
+
+	if newVar == nil {
+		labelNames, newVar = v.lazyInit(zero)
+	}
+
+	normalized := make([]string, len(labelNames))
+	copy(normalized, values)
+
+	key := strings.Join(normalized, "\xff")
+
+	if i, ok := v.m.Load(key); ok {
+		return i.(*vecChild).v
+	}
+
+	labels := make([]Label, len(labelNames))
+
+	for i, name := range labelNames {
+		labels[i] = Label{Name: name, Value: normalized[i]}
+	}
+
+	i, dup := v.m.LoadOrStore(key, &vecChild{labels: labels, v: newVar()})
+	if !dup {
+		v.addKey(key)
+	}
+
+	return i.(*vecChild).v
+}
+
+// Updates the sorted list of keys.
+func (v *vec) addKey(key string) {
+	v.keysMu.Lock()
+	defer v.keysMu.Unlock()
+
+	if i := sort.SearchStrings(v.keys, key); i >= len(v.keys) {
+		v.keys = append(v.keys, key)
+	} else if v.keys[i] != key {
+		v.keys = append(v.keys, "")
+		copy(v.keys[i+1:], v.keys[i:])
+		v.keys[i] = key
+	}
+}
+
+// Calls `f` for each variable, sorted by label values.
+func (v *vec) do(f func(labels []Label, v Var)) {
+	v.keysMu.RLock()
+	defer v.keysMu.RUnlock()
+
+	for _, k := range v.keys {
+		i, _ := v.m.Load(k)
+		child := i.(*vecChild)
+		f(child.labels, child.v)
+	}
+}
+
+// JSON array of the variables, and their labels.
+func (v *vec) string() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "[")
+
+	first := true
+
+	v.do(func(labels []Label, value Var) {
+		if !first {
+			fmt.Fprintf(&b, ", ")
+		}
+
+		first = false
+
+		m := make(map[string]string, len(labels))
+
+		for _, l := range labels {
+			m[l.Name] = l.Value
+		}
+
+		encoded, _ := json.Marshal(m)
+
+		fmt.Fprintf(&b, `{"labels": %s, "value": %s}`, encoded, value)
+	})
+
+	fmt.Fprintf(&b, "]")
+
+	return b.String()
+}
+
+//////
+// CounterVec type.
+//////
+
+// CounterVec is a set of counters, one per label values combination. It
+// satisfies the Var, and Collector interfaces. It's safe for concurrent use.
+// The zero value has no labels, use `Init`, or `NewCounterVec` to set them.
+type CounterVec struct {
+	vec
+}
+
+// Init sets the label names, and removes all counters.
+func (v *CounterVec) Init(labelNames ...string) *CounterVec {
+	v.init(func() Var { return new(Int) }, labelNames)
+	return v
+}
+
+// WithLabelValues returns the counter of `values`, in the label names order.
+func (v *CounterVec) WithLabelValues(values ...string) *Int {
+	return v.get(values, func() Var { return new(Int) }).(*Int)
+}
+
+// Add adds `delta` to the counter of `values`.
+func (v *CounterVec) Add(delta int64, values ...string) {
+	v.WithLabelValues(values...).Add(delta)
+}
+
+func (v *CounterVec) String() string {
+	return v.string()
+}
+
+// Collect satisfies the Collector interface.
+func (v *CounterVec) Collect(name string) []Family {
+	f := Family{Name: name, Type: TypeCounter}
+
+	v.do(func(labels []Label, value Var) {
+		f.Samples = append(f.Samples, Sample{
+			Labels: labels,
+			Name:   name,
+			Value:  float64(value.(*Int).Value()),
+		})
+	})
+
+	return []Family{f}
+}
+
+//////
+// HistogramVec type.
+//////
+
+// HistogramVec is a set of histograms sharing buckets, one per label values
+// combination. It satisfies the Var, and Collector interfaces. It's safe for
+// concurrent use. The zero value has no labels, and uses `DefaultBuckets`, use
+// `Init`, or `NewHistogramVec` to set them.
+type HistogramVec struct {
+	vec
+}
+
+// Init sets the buckets (`DefaultBuckets` if empty), the label names, and
+// removes all histograms.
+func (v *HistogramVec) Init(buckets []float64, labelNames ...string) *HistogramVec {
+	buckets = append([]float64{}, buckets...)
+
+	v.init(func() Var { return new(Histogram).Init(buckets...) }, labelNames)
+
+	return v
+}
+
+// WithLabelValues returns the histogram of `values`, in the label names order.
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.get(values, func() Var { return new(Histogram) }).(*Histogram)
+}
+
+// Observe adds `value` to the histogram of `values`.
+func (v *HistogramVec) Observe(value float64, values ...string) {
+	v.WithLabelValues(values...).Observe(value)
+}
+
+func (v *HistogramVec) String() string {
+	return v.string()
+}
+
+// Collect satisfies the Collector interface.
+func (v *HistogramVec) Collect(name string) []Family {
+	f := Family{Name: name, Type: TypeHistogram}
+
+	v.do(func(labels []Label, value Var) {
+		f.Samples = append(f.Samples, value.(*Histogram).samples(name, labels)...)
+	})
+
+	return []Family{f}
+}
+
+//////
+// Factory.
+//////
+
+// NewCounterVec creates, and publishes a counter vector.
+func NewCounterVec(name string, labelNames ...string) *CounterVec {
+	v := new(CounterVec).Init(labelNames...)
+	Publish(name, v)
+	return v
+}
+
+// NewHistogramVec creates, and publishes a histogram vector.
+func NewHistogramVec(name string, buckets []float64, labelNames ...string) *HistogramVec {
+	v := new(HistogramVec).Init(buckets, labelNames...)
+	Publish(name, v)
+	return v
+}
@@ -18,12 +18,15 @@
 package webserver
 
 import (
+	"crypto/tls"
+	"os"
 	"time"
 
 	"github.com/gorilla/mux"
 	handler "github.com/thalesfsp/webserver/handler"
 	"github.com/thalesfsp/webserver/metric"
 	"github.com/thalesfsp/webserver/telemetry"
+	otelmetric "go.opentelemetry.io/otel/metric"
 )
 
 //////
@@ -55,11 +58,76 @@ func WithTimeout(read, request, inflight, tasks, write time.Duration) Option {
 	}
 }
 
+// WithShutdownDrainPeriod sets for how long the server keeps serving after it's
+// marked as not ready, and before in-flight requests are drained. It gives load
+// balancers time to stop routing traffic.
+func WithShutdownDrainPeriod(period time.Duration) Option {
+	return func(s *Server) {
+		s.Timeout.ShutdownDrainPeriod = period
+	}
+}
+
+// WithSignals sets the OS signals which trigger the graceful shutdown. It
+// enables signal handling for `StartContext`, and overrides the default ones
+// for `Start`.
+func WithSignals(signals ...os.Signal) Option {
+	return func(s *Server) {
+		s.signals = signals
+	}
+}
+
+// WithTLS enables HTTPS, serving the certificate, and key files. Files are
+// watched, and reloaded when changed, without restarting the server.
+func WithTLS(certFile, keyFile string) Option {
+	return func(s *Server) {
+		if s.TLS == nil {
+			s.TLS = &TLS{}
+		}
+
+		s.TLS.CertFile = certFile
+		s.TLS.KeyFile = keyFile
+
+		if s.TLS.ReloadInterval == 0 {
+			s.TLS.ReloadInterval = defaultCertificateReloadInterval
+		}
+	}
+}
+
+// WithTLSConfig enables HTTPS using `config`. It can be combined with
+// `WithTLS`, in this case, certificates are loaded from the files.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(s *Server) {
+		if s.TLS == nil {
+			s.TLS = &TLS{}
+		}
+
+		s.TLS.Config = config
+	}
+}
+
+// WithClientCA requires clients to authenticate with a certificate verified
+// against the CA bundle (mTLS). The verified identity is available in the
+// request context, and in the access log.
+//
+// NOTE: Use it with `WithTLS`, or `WithTLSConfig`.
+//
+// SEE: `ClientIdentityFromContext`.
+func WithClientCA(caFile string) Option {
+	return func(s *Server) {
+		if s.TLS == nil {
+			s.TLS = &TLS{}
+		}
+
+		s.TLS.ClientCAFile = caFile
+	}
+}
+
 //////
 // Telemetry.
 //////
 
-// WithTelemetry sets telemetry.
+// WithTelemetry sets telemetry. It's flushed, and shutdown once other
+// shutdown tasks finished, see `WithTelemetryShutdown`.
 //
 // NOTE: Use `telemetry.New` to bring your own telemetry.
 //
@@ -72,6 +140,45 @@ func WithTelemetry(t *telemetry.Telemetry) Option {
 	}
 }
 
+// WithTelemetryShutdown sets whether the telemetry provider is shutdown, after
+// it's flushed, once other shutdown tasks finished, or only flushed, default:
+// true. Spans ended after the shutdown are dropped.
+//
+// NOTE: Disable it if the server restarts, or the telemetry is shared.
+func WithTelemetryShutdown(enabled bool) Option {
+	return func(s *Server) {
+		s.Tracing.ShutdownProvider = enabled
+	}
+}
+
+// WithPropagators sets the names of the propagators of the default
+// telemetry, e.g.: `b3`, and `jaeger`.
+//
+// NOTE: Ignored if telemetry is set via `WithTelemetry`, use
+// `telemetry.Propagators` instead.
+//
+// SEE: `telemetry.Propagators`.
+func WithPropagators(names ...string) Option {
+	return func(s *Server) {
+		s.EnableTelemetry = true
+
+		s.Tracing.Propagators = names
+	}
+}
+
+// WithTraceHeaders sets the response headers carrying the trace, and span IDs
+// of the request, and whether the W3C `traceparent` header is also set. Set a
+// header to "" to disable it.
+//
+// NOTE: Only set if telemetry is enabled.
+func WithTraceHeaders(traceIDHeader, spanIDHeader string, traceparent bool) Option {
+	return func(s *Server) {
+		s.Tracing.TraceIDHeader = traceIDHeader
+		s.Tracing.SpanIDHeader = spanIDHeader
+		s.Tracing.EchoTraceparent = traceparent
+	}
+}
+
 //////
 // Metrics.
 //////
@@ -87,6 +194,58 @@ func WithMetrics(metrics ...metric.Metric) Option {
 	}
 }
 
+// WithRegistry sets the server metrics registry, default: a new one.
+func WithRegistry(registry *metric.Registry) Option {
+	return func(s *Server) {
+		s.registry = registry
+	}
+}
+
+// WithGlobalMetrics controls whether metrics published in the package-level
+// registry (e.g.: via `metric.Publish`) are also served, default: true.
+func WithGlobalMetrics(enabled bool) Option {
+	return func(s *Server) {
+		s.EnableGlobalMetrics = enabled
+	}
+}
+
+// WithPrometheus enables metrics, also serving them in the Prometheus text
+// format at `/metrics`.
+func WithPrometheus() Option {
+	return func(s *Server) {
+		s.EnableMetrics = true
+		s.EnablePrometheus = true
+	}
+}
+
+// WithMeterProvider enables metrics, also exposing them through the
+// OpenTelemetry `provider`, so they share the pipeline (e.g.: readers, and
+// exporters) of traces. It takes precedence over `telemetry.MeterProvider`.
+//
+// NOTE: Only a provider is accepted, readers are set when creating it, e.g.:
+// `sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))`.
+func WithMeterProvider(provider otelmetric.MeterProvider) Option {
+	return func(s *Server) {
+		s.EnableMetrics = true
+
+		s.meterProvider = provider
+	}
+}
+
+// WithStatsD enables metrics, also pushing them to the StatsD server at
+// `address` (UDP), e.g.: `127.0.0.1:8125`. Metrics are flushed every interval,
+// and one last time during the shutdown task phase.
+//
+// NOTE: Use `metric.WithStatsDFormat(metric.DogStatsD)` for DogStatsD.
+func WithStatsD(address string, opts ...metric.StatsDOption) Option {
+	return func(s *Server) {
+		s.EnableMetrics = true
+
+		s.statsdAddress = address
+		s.statsdOptions = opts
+	}
+}
+
 //////
 // Logging.
 //////
@@ -117,6 +276,23 @@ func WithReadiness(readinessDeterminers ...*handler.ReadinessDeterminer) Option
 	}
 }
 
+// WithStartupHooks sets the list of startup hooks. They run in order when the
+// server starts, and a `/startup` probe reports `503` until all complete. If
+// any fails, the server is shutdown, and `Start` returns the error.
+func WithStartupHooks(hooks ...StartupHook) Option {
+	return func(s *Server) {
+		s.startupHooks = hooks
+	}
+}
+
+// WithHub sets the WebSocket connections hub, so it can be passed to
+// `handler.WebSocket` before the server is created.
+func WithHub(hub *handler.Hub) Option {
+	return func(s *Server) {
+		s.hub = hub
+	}
+}
+
 // WithHandlers sets the list of pre-loaded handlers.
 //
 // NOTE: Use `handler.New` to bring your own handler.
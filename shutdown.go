@@ -0,0 +1,643 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package webserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thalesfsp/customerror"
+	"github.com/thalesfsp/webserver/internal/middleware"
+	"github.com/thalesfsp/webserver/internal/runner"
+	"github.com/thalesfsp/webserver/internal/validation"
+)
+
+//////
+// Consts, and vars.
+//////
+
+// ShutdownCause indicates what triggered the shutdown.
+type ShutdownCause string
+
+const (
+	// ShutdownCauseContext indicates the `StartContext` context is done.
+	ShutdownCauseContext ShutdownCause = "context"
+
+	// ShutdownCauseShutdown indicates `Shutdown` was called.
+	ShutdownCauseShutdown ShutdownCause = "shutdown"
+
+	// ShutdownCauseSignal indicates an OS signal was received.
+	ShutdownCauseSignal ShutdownCause = "signal"
+
+	// ShutdownCauseStartup indicates a startup hook failed.
+	ShutdownCauseStartup ShutdownCause = "startup"
+
+	// ShutdownCauseStop indicates `Stop` was called.
+	ShutdownCauseStop ShutdownCause = "stop"
+)
+
+const (
+	crtlCmsg               = "press ctrl+c to stop anyway"
+	shutdownDeterminerName = "shutdown"
+)
+
+//////
+// Definitions.
+//////
+
+// ShutdownTaskFunc is a task which runs during the shutdown task phase, e.g.:
+// flush cache, close DB pools. It should return as soon as `ctx` is done.
+type ShutdownTaskFunc func(ctx context.Context) error
+
+// ShutdownTaskResult describes how a shutdown task went.
+type ShutdownTaskResult struct {
+	// Duration of the task.
+	Duration time.Duration `json:"duration"`
+
+	// Err returned by the task, if any.
+	Err error `json:"-"`
+
+	// Name of the task.
+	Name string `json:"name"`
+}
+
+// ShutdownError aggregates errors which happened during the shutdown.
+type ShutdownError struct {
+	// Errors which happened, in order.
+	Errors []error
+}
+
+// Error returns all errors, joined.
+func (e *ShutdownError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("failed to shutdown gracefully: %s", strings.Join(msgs, "; "))
+}
+
+// Is reports whether any of the errors matches `target`.
+func (e *ShutdownError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first error which matches `target`.
+func (e *ShutdownError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Unwrap returns all errors.
+func (e *ShutdownError) Unwrap() []error {
+	return e.Errors
+}
+
+// ShutdownResult describes how the shutdown went.
+type ShutdownResult struct {
+	// Cause of the shutdown.
+	Cause ShutdownCause `json:"cause"`
+
+	// Duration of the whole shutdown.
+	Duration time.Duration `json:"duration"`
+
+	// Err is the error which happened during shutdown, if any.
+	Err error `json:"-"`
+
+	// Graceful indicates all in-flight requests finished in time, and the
+	// server didn't need to be hard stopped.
+	Graceful bool `json:"graceful"`
+
+	// Signal which triggered the shutdown, if any.
+	Signal os.Signal `json:"-"`
+
+	// Tasks which ran, in order.
+	Tasks []ShutdownTaskResult `json:"tasks"`
+}
+
+// Shutdown task definition.
+type shutdownTask struct {
+	// Function to run.
+	Func ShutdownTaskFunc `json:"-" validate:"required"`
+
+	// Name of the task.
+	Name string `json:"name" validate:"required"`
+
+	// Priority of the task, lower runs first.
+	Priority int `json:"priority"`
+}
+
+// Request to shutdown the server.
+type shutdownRequest struct {
+	// Cause of the shutdown.
+	cause ShutdownCause
+
+	// Bounds the whole shutdown.
+	ctx context.Context
+
+	// Skips draining in-flight requests.
+	hard bool
+
+	// Signal which triggered the shutdown, if any.
+	signal os.Signal
+}
+
+// Lifecycle of a running server.
+type lifecycle struct {
+	// Closed once the server stopped.
+	done chan struct{}
+
+	// Cancelled once draining starts, ending streaming requests.
+	streams     context.Context
+	stopStreams context.CancelFunc
+
+	// Error which stopped the server, if any.
+	err error
+
+	// Shutdown requests. Only the first one is honored.
+	requests chan shutdownRequest
+
+	// How the shutdown went. `nil` if the server failed to start.
+	result *ShutdownResult
+}
+
+//////
+// Lifecycle.
+//////
+
+// Requests the shutdown, without blocking. It's a no-op if a shutdown was
+// already requested.
+func (l *lifecycle) request(r shutdownRequest) {
+	select {
+	case l.requests <- r:
+	default:
+	}
+}
+
+// Marks the server as stopped.
+func (l *lifecycle) finish(result *ShutdownResult, err error) {
+	l.result = result
+	l.err = err
+
+	l.stopStreams()
+
+	close(l.done)
+}
+
+// Returns the lifecycle of the current, or last server run.
+func (s *Server) getLifecycle() (*lifecycle, error) {
+	s.lifecycleMutex.Lock()
+	defer s.lifecycleMutex.Unlock()
+
+	if s.lifecycle == nil {
+		return nil, customerror.NewFailedToError("stop server, it was never started")
+	}
+
+	return s.lifecycle, nil
+}
+
+// Returns the context of streaming requests of the current server run. It's
+// never cancelled if the server isn't running, e.g.: router used directly.
+func (s *Server) streamsContext() context.Context {
+	s.lifecycleMutex.Lock()
+	defer s.lifecycleMutex.Unlock()
+
+	if s.lifecycle == nil {
+		return context.Background()
+	}
+
+	select {
+	case <-s.lifecycle.done:
+		return context.Background()
+	default:
+		return s.lifecycle.streams
+	}
+}
+
+// Begins a new lifecycle. Fails if the server is already running.
+func (s *Server) beginLifecycle() (*lifecycle, error) {
+	s.lifecycleMutex.Lock()
+	defer s.lifecycleMutex.Unlock()
+
+	if s.lifecycle != nil {
+		select {
+		case <-s.lifecycle.done:
+		default:
+			return nil, customerror.NewFailedToError("start server, it's already running")
+		}
+	}
+
+	streams, stopStreams := context.WithCancel(context.Background())
+
+	s.lifecycle = &lifecycle{
+		done:        make(chan struct{}),
+		requests:    make(chan shutdownRequest, 1),
+		streams:     streams,
+		stopStreams: stopStreams,
+	}
+
+	// The previous shutdown closed it.
+	s.hub.Open()
+
+	return s.lifecycle, nil
+}
+
+// Starts the server, and blocks until it's stopped. `signals` trigger the
+// graceful shutdown.
+func (s *Server) start(ctx context.Context, signals []os.Signal) (*ShutdownResult, error) {
+	tlsConfig, reloader, err := buildTLSConfig(s.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := s.beginLifecycle()
+	if err != nil {
+		return nil, err
+	}
+
+	// Instantiates the underlying HTTP server.
+	s.server = http.Server{
+		Addr:    s.Address,
+		Handler: s.GetRouter(),
+
+		// Allows streaming routes to clear the connection deadlines.
+		ConnContext: middleware.ContextWithConn,
+
+		// Best practice setting timeouts. It avoid "slowloris" attacks.
+		ReadTimeout:  s.Timeout.ReadTimeout,
+		WriteTimeout: s.Timeout.WriteTimeout,
+
+		TLSConfig: tlsConfig,
+	}
+
+	// Rotated certificates are swapped in while the server is running.
+	if reloader != nil {
+		watchCtx, stopWatching := context.WithCancel(context.Background())
+		defer stopWatching()
+
+		go reloader.Watch(watchCtx, s.TLS.ReloadInterval, func(err error) {
+			s.GetLogger().Errorlnf("failed to reload certificate, keeping the current one: %s", err)
+		})
+	}
+
+	// Metrics published after the server was created are also bridged.
+	if s.otelBridge != nil {
+		if err := s.otelBridge.Refresh(); err != nil {
+			s.GetLogger().Errorlnf("failed to bridge metrics to OpenTelemetry: %s", err)
+		}
+	}
+
+	// Metrics are pushed while the server is running. Pushing stops before
+	// the shutdown, which flushes them once more.
+	stopPushing := func() {}
+
+	if s.statsd != nil {
+		pushCtx, cancelPushing := context.WithCancel(context.Background())
+		pushDone := make(chan struct{})
+
+		stopPushing = func() {
+			cancelPushing()
+
+			<-pushDone
+		}
+
+		defer cancelPushing()
+
+		go func() {
+			defer close(pushDone)
+
+			s.statsd.Run(pushCtx, func(err error) {
+				s.GetLogger().Errorlnf("failed to push metrics: %s", err)
+			})
+		}()
+	}
+
+	// Warm-up work runs while the listener is up, so probes can report it.
+	// Other routes reply `503` until it completes.
+	if len(s.startupHooks) > 0 {
+		s.warmingUp.Store(true)
+		defer s.warmingUp.Store(false)
+	}
+
+	s.startupDeterminer.SetReadiness(false)
+	s.shutdownDeterminer.SetReadiness(true)
+
+	serverErr := make(chan error, 1)
+
+	// Non-blocking server start up.
+	go func() {
+		s.GetLogger().Debuglnf("server is about to start @ %s", s.Address)
+
+		if tlsConfig != nil {
+			// Certificates are already set in the TLS configuration.
+			serverErr <- s.server.ListenAndServeTLS("", "")
+
+			return
+		}
+
+		serverErr <- s.server.ListenAndServe()
+	}()
+
+	// Listen for OS signals, if any. A `nil` channel blocks forever.
+	var osSignals chan os.Signal
+
+	if len(signals) > 0 {
+		osSignals = make(chan os.Signal, 1)
+
+		signal.Notify(osSignals, signals...)
+		defer signal.Stop(osSignals)
+	}
+
+	hooksCtx, cancelHooks := context.WithCancel(ctx)
+	defer cancelHooks()
+
+	hooksErr := make(chan error, 1)
+
+	go func() {
+		hooksErr <- s.runStartupHooks(hooksCtx)
+	}()
+
+	var (
+		request    *shutdownRequest
+		startupErr error
+	)
+
+	// Block execution, and listen for any server errors (e.g.: "port in use"),
+	// startup hooks result, context cancellation, shutdown requests, or OS
+	// signals.
+	for request == nil {
+		select {
+		// These errors don't require graceful shutdown.
+		case err := <-serverErr:
+			l.finish(nil, err)
+
+			return nil, err
+		case err := <-hooksErr:
+			if err != nil {
+				startupErr = err
+
+				request = &shutdownRequest{cause: ShutdownCauseStartup, ctx: context.Background()}
+
+				break
+			}
+
+			s.GetLogger().Debuglnf("server started @ %s", s.Address)
+
+			s.startupDeterminer.SetReadiness(true)
+			s.warmingUp.Store(false)
+
+			// A `nil` channel blocks forever.
+			hooksErr = nil
+		case <-ctx.Done():
+			request = &shutdownRequest{cause: ShutdownCauseContext, ctx: context.Background()}
+		case r := <-l.requests:
+			request = &r
+		case sig := <-osSignals:
+			// Let Go terminate the program if we get that signal again.
+			signal.Stop(osSignals)
+
+			s.logger.PrintNewLine()
+
+			request = &shutdownRequest{cause: ShutdownCauseSignal, ctx: context.Background(), signal: sig}
+		}
+	}
+
+	cancelHooks()
+	stopPushing()
+
+	result := s.shutdown(*request, serverErr)
+
+	// A failed startup hook is the root cause, shutdown errors are secondary.
+	err = result.Err
+
+	if startupErr != nil {
+		err = startupErr
+	}
+
+	l.finish(result, err)
+
+	return result, err
+}
+
+// Shutdowns the server: drains in-flight requests, and waits for tasks.
+func (s *Server) shutdown(request shutdownRequest, serverErr <-chan error) *ShutdownResult {
+	began := time.Now()
+
+	result := &ShutdownResult{
+		Cause:    request.cause,
+		Graceful: !request.hard,
+		Signal:   request.signal,
+	}
+
+	if request.signal != nil {
+		s.GetLogger().Tracelnf("Got %s signal (%s), shutting down", request.signal, request.cause)
+	} else {
+		s.GetLogger().Tracelnf("Got %s request, shutting down", request.cause)
+	}
+
+	errs := []error{}
+
+	// Load balancers should stop routing traffic to the server.
+	s.shutdownDeterminer.SetReadiness(false)
+
+	s.GetLogger().Traceln("Marked server as not ready")
+
+	if request.hard {
+		// Hijacked connections aren't closed by the server.
+		closed, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_ = s.hub.Close(closed)
+
+		// Well.. KIH: Kill It Hard.
+		if err := s.server.Close(); err != nil {
+			errs = append(errs, customerror.NewFailedToError("hardly shutdown the server", customerror.WithError(err)))
+		}
+	} else {
+		s.waitDrainPeriod(request.ctx)
+
+		if err := s.drain(request.ctx); err != nil {
+			result.Graceful = false
+
+			errs = append(errs, err)
+		}
+	}
+
+	// Run tasks such as flush cache and files, and telemetry.
+	result.Tasks = s.runShutdownTasks(request.ctx)
+
+	for _, task := range result.Tasks {
+		if task.Err != nil {
+			errs = append(errs, task.Err)
+		}
+	}
+
+	// If reaches here, error can be safely collected.
+	if err := <-serverErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		result.Err = &ShutdownError{Errors: errs}
+	}
+
+	result.Duration = time.Since(began)
+
+	return result
+}
+
+// Runs shutdown tasks in priority order. `ShutdownTaskTimeout` is the deadline
+// for all of them, once reached, remaining tasks are skipped.
+func (s *Server) runShutdownTasks(ctx context.Context) []ShutdownTaskResult {
+	s.shutdownTasksMutex.Lock()
+	tasks := make([]shutdownTask, len(s.shutdownTasks))
+	copy(tasks, s.shutdownTasks)
+	s.shutdownTasksMutex.Unlock()
+
+	// Same priority tasks run in the registration order.
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].Priority < tasks[j].Priority
+	})
+
+	results := make([]ShutdownTaskResult, 0, len(tasks))
+
+	if len(tasks) == 0 {
+		return results
+	}
+
+	s.GetLogger().Tracelnf("Waiting up to %s for %d tasks, %s", s.ShutdownTaskTimeout, len(tasks), crtlCmsg)
+
+	ctx, cancel := context.WithTimeout(ctx, s.ShutdownTaskTimeout)
+	defer cancel()
+
+	for _, task := range tasks {
+		began := time.Now()
+
+		err := runner.Run(ctx, task.Func)
+		if err != nil {
+			err = customerror.NewFailedToError(
+				fmt.Sprintf("run shutdown task %s", task.Name),
+				customerror.WithError(err),
+			)
+		}
+
+		s.GetLogger().Tracelnf("Shutdown task %s finished in %s, error: %v", task.Name, time.Since(began), err)
+
+		results = append(results, ShutdownTaskResult{
+			Duration: time.Since(began),
+			Err:      err,
+			Name:     task.Name,
+		})
+	}
+
+	return results
+}
+
+// RegisterShutdownTask registers a task which runs after in-flight requests
+// are drained, e.g.: flush caches, close DB pools. Tasks run in ascending
+// `priority` order, same priority tasks run in the registration order. All
+// tasks share the `ShutdownTaskTimeout` deadline. Errors are aggregated in the
+// shutdown error.
+func (s *Server) RegisterShutdownTask(name string, priority int, fn ShutdownTaskFunc) error {
+	task := shutdownTask{
+		Func:     fn,
+		Name:     name,
+		Priority: priority,
+	}
+
+	if err := validation.ValidateStruct(task); err != nil {
+		return err
+	}
+
+	s.shutdownTasksMutex.Lock()
+	defer s.shutdownTasksMutex.Unlock()
+
+	s.shutdownTasks = append(s.shutdownTasks, task)
+
+	return nil
+}
+
+// Keeps serving for `ShutdownDrainPeriod`, while load balancers notice the
+// server isn't ready anymore.
+func (s *Server) waitDrainPeriod(ctx context.Context) {
+	if s.ShutdownDrainPeriod <= 0 {
+		return
+	}
+
+	s.GetLogger().Tracelnf("Waiting %s drain period, still serving, %s", s.ShutdownDrainPeriod, crtlCmsg)
+
+	timer := time.NewTimer(s.ShutdownDrainPeriod)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// Gracefully shutdowns the server by closing the listener, waiting the
+// completion of all in-flight requests. If it times out, the server is hard
+// stopped.
+func (s *Server) drain(ctx context.Context) error {
+	s.GetLogger().Tracelnf("Waiting %s for inflight requests to finish, %s", s.ShutdownInFlightTimeout, crtlCmsg)
+
+	ctx, cancel := context.WithTimeout(ctx, s.ShutdownInFlightTimeout)
+	defer cancel()
+
+	s.server.SetKeepAlivesEnabled(false)
+
+	// Streaming requests only end once the client disconnects, otherwise.
+	if l, err := s.getLifecycle(); err == nil {
+		l.stopStreams()
+	}
+
+	// WebSocket connections are hijacked, so the server doesn't track them.
+	if err := s.hub.Close(ctx); err != nil {
+		s.GetLogger().Traceln("WebSocket connections didn't close in time, closed hard")
+	}
+
+	err := s.server.Shutdown(ctx)
+	if err == nil {
+		return nil
+	}
+
+	shutdownErr := err
+
+	if isTimeoutError(err) {
+		shutdownErr = customerror.NewFailedToError(
+			"gracefully shutdown, timeout reached. Stopping hard...",
+			customerror.WithError(err),
+		)
+	}
+
+	// Well.. KIH: Kill It Hard.
+	if err := s.server.Close(); err != nil {
+		shutdownErr = customerror.NewFailedToError(
+			"hardly shutdown the server",
+			customerror.WithError(err),
+		)
+	}
+
+	return shutdownErr
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package webserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thalesfsp/customerror"
+	"github.com/thalesfsp/webserver/internal/runner"
+)
+
+//////
+// Consts, and vars.
+//////
+
+const startupDeterminerName = "startup"
+
+//////
+// Definitions.
+//////
+
+// StartupHook is warm-up work, e.g.: migrations, cache priming, connection
+// checks, which runs when the server starts. Until all hooks complete, only
+// probes are served: the startup probe (`/startup`), and readiness report
+// `503`, other routes reply `503` with `ErrStarting`.
+type StartupHook struct {
+	// Func to run. It should return as soon as `ctx` is done.
+	Func func(ctx context.Context) error `json:"-" validate:"required"`
+
+	// Name of the hook.
+	Name string `json:"name" validate:"required"`
+
+	// Timeout max duration of the hook.
+	Timeout time.Duration `json:"timeout" validate:"required"`
+}
+
+//////
+// Helpers.
+//////
+
+// Runs startup hooks in order, stopping at the first failure. The startup
+// determiner is named after the running hook, so probes report it.
+func (s *Server) runStartupHooks(ctx context.Context) error {
+	defer s.startupDeterminer.SetName(startupDeterminerName)
+
+	for _, hook := range s.startupHooks {
+		began := time.Now()
+
+		s.startupDeterminer.SetName(hook.Name)
+
+		hookCtx, cancel := context.WithTimeout(ctx, hook.Timeout)
+
+		err := runner.Run(hookCtx, hook.Func)
+
+		cancel()
+
+		s.GetLogger().Tracelnf("Startup hook %s finished in %s, error: %v", hook.Name, time.Since(began), err)
+
+		if err == nil {
+			continue
+		}
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			return customerror.NewFailedToError(
+				fmt.Sprintf("run startup hook %s, timed out after %s", hook.Name, hook.Timeout),
+				customerror.WithError(err),
+			)
+		}
+
+		return customerror.NewFailedToError(
+			fmt.Sprintf("run startup hook %s", hook.Name),
+			customerror.WithError(err),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/thalesfsp/customerror"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+//////
+// Definitions.
+//////
+
+// SpanRecorder records ended spans, in the order they ended. It satisfies the
+// `sdktrace.SpanProcessor` interface.
+type SpanRecorder struct {
+	m     sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+// OnStart satisfies the `sdktrace.SpanProcessor` interface.
+func (r *SpanRecorder) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {}
+
+// OnEnd satisfies the `sdktrace.SpanProcessor` interface.
+func (r *SpanRecorder) OnEnd(s sdktrace.ReadOnlySpan) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.spans = append(r.spans, s)
+}
+
+// Shutdown satisfies the `sdktrace.SpanProcessor` interface.
+func (r *SpanRecorder) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// ForceFlush satisfies the `sdktrace.SpanProcessor` interface.
+func (r *SpanRecorder) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+// Spans returns the ended spans.
+func (r *SpanRecorder) Spans() []sdktrace.ReadOnlySpan {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return append([]sdktrace.ReadOnlySpan{}, r.spans...)
+}
+
+// Reset removes all recorded spans.
+func (r *SpanRecorder) Reset() {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.spans = nil
+}
+
+// FindSpans returns the ended spans named `name`.
+func (r *SpanRecorder) FindSpans(name string) []sdktrace.ReadOnlySpan {
+	spans := []sdktrace.ReadOnlySpan{}
+
+	for _, s := range r.Spans() {
+		if s.Name() == name {
+			spans = append(spans, s)
+		}
+	}
+
+	return spans
+}
+
+// FindSpan returns the first ended span named `name`, if any.
+func (r *SpanRecorder) FindSpan(name string) (sdktrace.ReadOnlySpan, bool) {
+	spans := r.FindSpans(name)
+	if len(spans) == 0 {
+		return nil, false
+	}
+
+	return spans[0], true
+}
+
+// Parent returns the parent of `span`, if it ended.
+func (r *SpanRecorder) Parent(span sdktrace.ReadOnlySpan) (sdktrace.ReadOnlySpan, bool) {
+	if !span.Parent().IsValid() {
+		return nil, false
+	}
+
+	for _, s := range r.Spans() {
+		if s.SpanContext().SpanID() == span.Parent().SpanID() &&
+			s.SpanContext().TraceID() == span.Parent().TraceID() {
+			return s, true
+		}
+	}
+
+	return nil, false
+}
+
+// Children returns the ended spans which parent is `span`.
+func (r *SpanRecorder) Children(span sdktrace.ReadOnlySpan) []sdktrace.ReadOnlySpan {
+	children := []sdktrace.ReadOnlySpan{}
+
+	for _, s := range r.Spans() {
+		if s.Parent().SpanID() == span.SpanContext().SpanID() &&
+			s.Parent().TraceID() == span.SpanContext().TraceID() {
+			children = append(children, s)
+		}
+	}
+
+	return children
+}
+
+//////
+// Helpers.
+//////
+
+// Attribute returns the value of the `key` attribute of `span`, if any.
+func Attribute(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, a := range span.Attributes() {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+
+	return attribute.Value{}, false
+}
+
+// AssertAttributes verifies `span` has all `attrs`, e.g.:
+// `AssertAttributes(span, attribute.String("http.method", "GET"))`. The
+// error describes the first missing, or different one.
+func AssertAttributes(span sdktrace.ReadOnlySpan, attrs ...attribute.KeyValue) error {
+	for _, expected := range attrs {
+		got, ok := Attribute(span, expected.Key)
+		if !ok {
+			return customerror.NewMissingError(fmt.Sprintf("span %s attribute %s", span.Name(), expected.Key))
+		}
+
+		if got != expected.Value {
+			return customerror.NewInvalidError(fmt.Sprintf(
+				"span %s attribute %s, expected %s, got %s",
+				span.Name(), expected.Key, expected.Value.Emit(), got.Emit(),
+			))
+		}
+	}
+
+	return nil
+}
+
+//////
+// Factory.
+//////
+
+// InMemoryProvider returns a telemetry which records spans in memory, and
+// samples every trace. Use the recorder to assert spans in tests. Context is
+// propagated by the `propagators` named, default: `tracecontext`, and
+// `baggage`.
+//
+// SEE: `Propagators`.
+func InMemoryProvider(name string, propagators ...string) (*Telemetry, *SpanRecorder, error) {
+	textMapPropagators, err := propagatorsOrDefault(propagators)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recorder := &SpanRecorder{}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+
+	t, err := New(name, provider, textMapPropagators...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return t, recorder, nil
+}
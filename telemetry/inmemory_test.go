@@ -0,0 +1,96 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestInMemoryProvider(t *testing.T) {
+	telemetry, recorder, err := InMemoryProvider("test-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := telemetry.NewTracer("test")
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttributes(attribute.String("key", "value"), attribute.Int("count", 2))
+	child.End()
+
+	// Not ended, so not recorded.
+	_, unfinished := tracer.Start(ctx, "unfinished")
+	defer unfinished.End()
+
+	parent.End()
+
+	if len(recorder.Spans()) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(recorder.Spans()))
+	}
+
+	p, ok := recorder.FindSpan("parent")
+	if !ok {
+		t.Fatal("Expected parent span")
+	}
+
+	c, ok := recorder.FindSpan("child")
+	if !ok {
+		t.Fatal("Expected child span")
+	}
+
+	if got, ok := recorder.Parent(c); !ok || got.Name() != "parent" {
+		t.Fatal("Expected parent to be the child parent")
+	}
+
+	if _, ok := recorder.Parent(p); ok {
+		t.Fatal("Expected parent to be a root span")
+	}
+
+	if children := recorder.Children(p); len(children) != 1 || children[0].Name() != "child" {
+		t.Fatalf("Expected child to be the only parent child, got %v", children)
+	}
+
+	if err := AssertAttributes(c, attribute.String("key", "value"), attribute.Int("count", 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AssertAttributes(c, attribute.String("key", "other")); err == nil {
+		t.Fatal("Expected error for different attribute")
+	}
+
+	if err := AssertAttributes(c, attribute.String("missing", "value")); err == nil {
+		t.Fatal("Expected error for missing attribute")
+	}
+
+	recorder.Reset()
+
+	if _, ok := recorder.FindSpan("parent"); ok {
+		t.Fatal("Expected no spans after reset")
+	}
+}
+
+func TestInMemoryProvider_propagators(t *testing.T) {
+	telemetry, _, err := InMemoryProvider("test-service", PropagatorB3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(telemetry.TextMapPropagator) != 1 {
+		t.Fatalf("Expected the b3 propagator, got %v", telemetry.TextMapPropagator)
+	}
+
+	if _, ok := telemetry.TextMapPropagator[0].(B3Propagator); !ok {
+		t.Fatalf("Expected the b3 propagator, got %T", telemetry.TextMapPropagator[0])
+	}
+
+	if _, _, err := InMemoryProvider("test-service", "zipkin"); err == nil {
+		t.Fatal("Expected error for unknown propagator")
+	}
+}
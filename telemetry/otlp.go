@@ -0,0 +1,280 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/thalesfsp/customerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+//////
+// Consts, and vars.
+//////
+
+// OTLPProtocol is the transport used to export spans.
+type OTLPProtocol string
+
+const (
+	// OTLPProtocolGRPC exports spans via gRPC, default port: 4317.
+	OTLPProtocolGRPC OTLPProtocol = "grpc"
+
+	// OTLPProtocolHTTP exports spans via HTTP, protobuf encoded, default
+	// port: 4318.
+	OTLPProtocolHTTP OTLPProtocol = "http/protobuf"
+)
+
+const (
+	defaultOTLPGRPCEndpoint = "localhost:4317"
+	defaultOTLPHTTPEndpoint = "localhost:4318"
+	defaultOTLPTimeout      = 10 * time.Second
+)
+
+//////
+// Options.
+//////
+
+// OTLP provider settings.
+type otlpConfig struct {
+	batchOptions []sdktrace.BatchSpanProcessorOption
+	endpoint     string
+	environment  string
+	headers      map[string]string
+	insecure     bool
+	propagators  []string
+	protocol     OTLPProtocol
+	resource     []attribute.KeyValue
+	sampler      sdktrace.Sampler
+	timeout      time.Duration
+	version      string
+}
+
+// OTLPOption allows to specify options.
+type OTLPOption func(c *otlpConfig)
+
+// WithOTLPEndpoint sets the collector address, e.g.: `collector:4317`,
+// default: `localhost:4317` for gRPC, and `localhost:4318` for HTTP.
+func WithOTLPEndpoint(endpoint string) OTLPOption {
+	return func(c *otlpConfig) {
+		c.endpoint = endpoint
+	}
+}
+
+// WithOTLPProtocol sets the transport, default: `OTLPProtocolGRPC`.
+func WithOTLPProtocol(protocol OTLPProtocol) OTLPOption {
+	return func(c *otlpConfig) {
+		c.protocol = protocol
+	}
+}
+
+// WithOTLPInsecure disables TLS, e.g.: for a collector sidecar.
+func WithOTLPInsecure() OTLPOption {
+	return func(c *otlpConfig) {
+		c.insecure = true
+	}
+}
+
+// WithOTLPHeaders sets headers sent with every export, e.g.: API keys.
+func WithOTLPHeaders(headers map[string]string) OTLPOption {
+	return func(c *otlpConfig) {
+		c.headers = headers
+	}
+}
+
+// WithOTLPTimeout sets the max duration of an export, default: 10s.
+func WithOTLPTimeout(timeout time.Duration) OTLPOption {
+	return func(c *otlpConfig) {
+		c.timeout = timeout
+	}
+}
+
+// WithSampler sets the sampler, default: `ParentBasedSampler` sampling every
+// root.
+//
+// SEE: `RatioSampler`, `ParentBasedSampler`, and `RateLimitedSampler`.
+func WithSampler(sampler sdktrace.Sampler) OTLPOption {
+	return func(c *otlpConfig) {
+		c.sampler = sampler
+	}
+}
+
+// WithBatch sets how spans are batched before exported. Zero values keep the
+// OpenTelemetry defaults: up to 2048 queued spans, exported in batches of up
+// to 512, at least every 5s.
+func WithBatch(maxQueueSize, maxExportBatchSize int, batchTimeout time.Duration) OTLPOption {
+	return func(c *otlpConfig) {
+		if maxQueueSize > 0 {
+			c.batchOptions = append(c.batchOptions, sdktrace.WithMaxQueueSize(maxQueueSize))
+		}
+
+		if maxExportBatchSize > 0 {
+			c.batchOptions = append(c.batchOptions, sdktrace.WithMaxExportBatchSize(maxExportBatchSize))
+		}
+
+		if batchTimeout > 0 {
+			c.batchOptions = append(c.batchOptions, sdktrace.WithBatchTimeout(batchTimeout))
+		}
+	}
+}
+
+// WithPropagators sets the names of the propagators, e.g.: `b3`, default:
+// `tracecontext`, and `baggage`.
+//
+// SEE: `Propagators`.
+func WithPropagators(names ...string) OTLPOption {
+	return func(c *otlpConfig) {
+		c.propagators = names
+	}
+}
+
+// WithServiceVersion sets the `service.version` resource attribute.
+func WithServiceVersion(version string) OTLPOption {
+	return func(c *otlpConfig) {
+		c.version = version
+	}
+}
+
+// WithEnvironment sets the `deployment.environment` resource attribute,
+// e.g.: `production`.
+func WithEnvironment(environment string) OTLPOption {
+	return func(c *otlpConfig) {
+		c.environment = environment
+	}
+}
+
+// WithResourceAttributes adds resource attributes, e.g.: `k8s.pod.name`.
+func WithResourceAttributes(attrs ...attribute.KeyValue) OTLPOption {
+	return func(c *otlpConfig) {
+		c.resource = append(c.resource, attrs...)
+	}
+}
+
+//////
+// Helpers.
+//////
+
+// Creates the OTLP client of `c`.
+func newOTLPClient(c *otlpConfig) (otlptrace.Client, error) {
+	switch c.protocol {
+	case OTLPProtocolGRPC:
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(c.endpoint),
+			otlptracegrpc.WithHeaders(c.headers),
+			otlptracegrpc.WithTimeout(c.timeout),
+		}
+
+		if c.insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		return otlptracegrpc.NewClient(opts...), nil
+	case OTLPProtocolHTTP:
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(c.endpoint),
+			otlptracehttp.WithHeaders(c.headers),
+			otlptracehttp.WithTimeout(c.timeout),
+		}
+
+		if c.insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		return otlptracehttp.NewClient(opts...), nil
+	default:
+		return nil, customerror.NewInvalidError(fmt.Sprintf("OTLP protocol %s", c.protocol))
+	}
+}
+
+// Describes the service producing spans.
+func newResource(name string, c *otlpConfig) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{semconv.ServiceNameKey.String(name)}
+
+	if c.version != "" {
+		attrs = append(attrs, semconv.ServiceVersionKey.String(c.version))
+	}
+
+	if c.environment != "" {
+		attrs = append(attrs, semconv.DeploymentEnvironmentKey.String(c.environment))
+	}
+
+	attrs = append(attrs, c.resource...)
+
+	r, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, attrs...))
+	if err != nil {
+		return nil, customerror.NewFailedToError("create telemetry resource", customerror.WithError(err))
+	}
+
+	return r, nil
+}
+
+//////
+// Factory.
+//////
+
+// OTLPProvider returns a telemetry which exports to an OpenTelemetry
+// collector via OTLP. `name` is the `service.name` resource attribute.
+//
+// NOTE: Spans are batched, and sent in the background.
+func OTLPProvider(name string, opts ...OTLPOption) (*Telemetry, error) {
+	c := &otlpConfig{
+		protocol: OTLPProtocolGRPC,
+		sampler:  ParentBasedSampler(sdktrace.AlwaysSample()),
+		timeout:  defaultOTLPTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.endpoint == "" {
+		c.endpoint = defaultOTLPGRPCEndpoint
+
+		if c.protocol == OTLPProtocolHTTP {
+			c.endpoint = defaultOTLPHTTPEndpoint
+		}
+	}
+
+	textMapPropagators, err := propagatorsOrDefault(c.propagators)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newOTLPClient(c)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newResource(name, c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Connecting is non-blocking, spans are sent once the collector is up.
+	exporter, err := otlptrace.New(context.Background(), client)
+	if err != nil {
+		return nil, customerror.NewFailedToError("create OTLP exporter", customerror.WithError(err))
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(c.sampler),
+		sdktrace.WithBatcher(exporter, c.batchOptions...),
+		sdktrace.WithResource(r),
+	)
+
+	return New(
+		name,
+		provider,
+		textMapPropagators...,
+	)
+}
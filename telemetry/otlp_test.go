@@ -0,0 +1,254 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Serves a collector stand-in via HTTP, recording exported requests bodies.
+// Strings are raw bytes in protobuf, so they can be looked up without
+// decoding it. Returns its address.
+func serveOTLPHTTP(t *testing.T) (string, func() []byte) {
+	t.Helper()
+
+	var (
+		m        sync.Mutex
+		received []byte
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		m.Lock()
+		received = append(received, body...)
+		m.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://"), func() []byte {
+		m.Lock()
+		defer m.Unlock()
+
+		return received
+	}
+}
+
+func TestOTLPProvider(t *testing.T) {
+	t.Run(string(OTLPProtocolHTTP), func(t *testing.T) {
+		endpoint, received := serveOTLPHTTP(t)
+
+		telemetry, err := OTLPProvider("test-service",
+			WithOTLPEndpoint(endpoint),
+			WithOTLPProtocol(OTLPProtocolHTTP),
+			WithOTLPInsecure(),
+			WithBatch(10, 5, time.Hour),
+			WithServiceVersion("1.2.3"),
+			WithEnvironment("test"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, span := telemetry.Provider.Tracer("test").Start(context.Background(), "operation")
+		span.End()
+
+		provider := telemetry.Provider.(*sdktrace.TracerProvider)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := provider.ForceFlush(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := provider.Shutdown(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		body := received()
+
+		for _, want := range []string{"operation", "service.name", "test-service", "service.version", "1.2.3", "deployment.environment", "test"} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("Expected %q to be exported", want)
+			}
+		}
+	})
+
+	// gRPC clients start with the HTTP/2 preface.
+	t.Run(string(OTLPProtocolGRPC), func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer l.Close()
+
+		telemetry, err := OTLPProvider("test-service",
+			WithOTLPEndpoint(l.Addr().String()),
+			WithOTLPInsecure(),
+			WithBatch(10, 5, time.Hour),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, span := telemetry.Provider.Tracer("test").Start(context.Background(), "operation")
+		span.End()
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			_ = telemetry.Provider.(*sdktrace.TracerProvider).Shutdown(ctx)
+		}()
+
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer conn.Close()
+
+		if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		preface := make([]byte, len("PRI * HTTP/2.0"))
+
+		if _, err := io.ReadFull(conn, preface); err != nil || string(preface) != "PRI * HTTP/2.0" {
+			t.Fatalf("Expected the HTTP/2 preface, got %q, %v", preface, err)
+		}
+	})
+
+	if _, err := OTLPProvider("test-service", WithOTLPProtocol("thrift")); err == nil {
+		t.Fatal("Expected error for invalid protocol")
+	}
+}
+
+func TestRateLimitedSampler(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	sampler := RateLimitedSampler(2).(*rateLimitedSampler)
+	sampler.now = func() time.Time { return now }
+
+	sampled := func() int {
+		n := 0
+
+		for i := 0; i < 10; i++ {
+			result := sampler.ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: context.Background(),
+				TraceID:       trace.TraceID{byte(i + 1)},
+			})
+
+			if result.Decision == sdktrace.RecordAndSample {
+				n++
+			}
+		}
+
+		return n
+	}
+
+	// Burst.
+	if n := sampled(); n != 2 {
+		t.Fatalf("Expected 2 sampled, got %d", n)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+
+	if n := sampled(); n != 1 {
+		t.Fatalf("Expected 1 sampled after 500ms, got %d", n)
+	}
+
+	// Tokens don't accumulate beyond the burst.
+	now = now.Add(time.Minute)
+
+	if n := sampled(); n != 2 {
+		t.Fatalf("Expected 2 sampled after 1m, got %d", n)
+	}
+}
+
+func TestParentBasedSampler_deferred(t *testing.T) {
+	sampler := ParentBasedSampler(sdktrace.AlwaysSample())
+
+	propagators, err := Propagators(PropagatorB3, PropagatorB3Multi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	propagator := propagation.NewCompositeTextMapPropagator(propagators...)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    sdktrace.SamplingDecision
+	}{
+		{
+			name:    "b3 deferred",
+			headers: map[string]string{"b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+			want:    sdktrace.RecordAndSample,
+		},
+		{
+			name: "b3multi deferred",
+			headers: map[string]string{
+				"X-B3-TraceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"X-B3-SpanId":  "00f067aa0ba902b7",
+			},
+			want: sdktrace.RecordAndSample,
+		},
+		{
+			name:    "b3 not sampled",
+			headers: map[string]string{"b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0"},
+			want:    sdktrace.Drop,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			carrier := propagation.HeaderCarrier(http.Header{})
+
+			for k, v := range tt.headers {
+				carrier.Set(k, v)
+			}
+
+			ctx := propagator.Extract(context.Background(), carrier)
+
+			result := sampler.ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: ctx,
+				TraceID:       trace.SpanContextFromContext(ctx).TraceID(),
+			})
+
+			if result.Decision != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, result.Decision)
+			}
+		})
+	}
+}
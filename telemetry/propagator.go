@@ -0,0 +1,302 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/thalesfsp/customerror"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//////
+// Consts, and vars.
+//////
+
+// Propagator names, as in the `OTEL_PROPAGATORS` environment variable.
+const (
+	// PropagatorTraceContext is the W3C `traceparent`, and `tracestate`
+	// headers.
+	PropagatorTraceContext = "tracecontext"
+
+	// PropagatorBaggage is the W3C `baggage` header.
+	PropagatorBaggage = "baggage"
+
+	// PropagatorB3 is the Zipkin B3 single `b3` header.
+	PropagatorB3 = "b3"
+
+	// PropagatorB3Multi is the Zipkin B3 multiple `X-B3-*` headers.
+	PropagatorB3Multi = "b3multi"
+
+	// PropagatorJaeger is the Jaeger `uber-trace-id` header.
+	PropagatorJaeger = "jaeger"
+)
+
+const (
+	b3Header             = "b3"
+	b3TraceIDHeader      = "X-B3-TraceId"
+	b3SpanIDHeader       = "X-B3-SpanId"
+	b3ParentSpanIDHeader = "X-B3-ParentSpanId"
+	b3SampledHeader      = "X-B3-Sampled"
+	b3FlagsHeader        = "X-B3-Flags"
+	jaegerHeader         = "uber-trace-id"
+
+	// Jaeger flags.
+	jaegerSampled = 0x1
+	jaegerDebug   = 0x2
+)
+
+//////
+// B3.
+//////
+
+// B3Propagator propagates the trace context via the Zipkin B3 single header,
+// format: `{trace-id}-{span-id}-{sampled}-{parent-span-id}`. It satisfies the
+// `propagation.TextMapPropagator` interface.
+//
+// NOTE: Without the sampling state, the decision is deferred to the sampler,
+// if it's a `ParentBasedSampler`, otherwise the trace isn't sampled.
+//
+// SEE: https://github.com/openzipkin/b3-propagation
+type B3Propagator struct{}
+
+// Inject satisfies the `propagation.TextMapPropagator` interface.
+func (B3Propagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	carrier.Set(b3Header, fmt.Sprintf("%s-%s-%s", sc.TraceID(), sc.SpanID(), sampledFlag(sc)))
+}
+
+// Extract satisfies the `propagation.TextMapPropagator` interface.
+func (B3Propagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	parts := strings.Split(carrier.Get(b3Header), "-")
+
+	// Sampling only, or malformed.
+	if len(parts) < 2 || len(parts) > 4 {
+		return ctx
+	}
+
+	sampled := ""
+
+	if len(parts) > 2 {
+		sampled = parts[2]
+	}
+
+	return withRemoteSpanContext(ctx, parts[0], parts[1], sampled, false)
+}
+
+// Fields satisfies the `propagation.TextMapPropagator` interface.
+func (B3Propagator) Fields() []string {
+	return []string{b3Header}
+}
+
+// B3MultiPropagator propagates the trace context via the Zipkin B3 multiple
+// `X-B3-*` headers. It satisfies the `propagation.TextMapPropagator` interface.
+//
+// NOTE: Without the sampling state, the decision is deferred to the sampler,
+// if it's a `ParentBasedSampler`, otherwise the trace isn't sampled.
+//
+// SEE: https://github.com/openzipkin/b3-propagation
+type B3MultiPropagator struct{}
+
+// Inject satisfies the `propagation.TextMapPropagator` interface.
+func (B3MultiPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	carrier.Set(b3TraceIDHeader, sc.TraceID().String())
+	carrier.Set(b3SpanIDHeader, sc.SpanID().String())
+	carrier.Set(b3SampledHeader, sampledFlag(sc))
+}
+
+// Extract satisfies the `propagation.TextMapPropagator` interface.
+func (B3MultiPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return withRemoteSpanContext(
+		ctx,
+		carrier.Get(b3TraceIDHeader),
+		carrier.Get(b3SpanIDHeader),
+		carrier.Get(b3SampledHeader),
+		carrier.Get(b3FlagsHeader) == "1",
+	)
+}
+
+// Fields satisfies the `propagation.TextMapPropagator` interface.
+func (B3MultiPropagator) Fields() []string {
+	return []string{b3TraceIDHeader, b3SpanIDHeader, b3ParentSpanIDHeader, b3SampledHeader, b3FlagsHeader}
+}
+
+//////
+// Jaeger.
+//////
+
+// JaegerPropagator propagates the trace context via the Jaeger
+// `uber-trace-id` header, format:
+// `{trace-id}:{span-id}:{parent-span-id}:{flags}`. It satisfies the
+// `propagation.TextMapPropagator` interface.
+//
+// NOTE: Jaeger baggage (`uberctx-*` headers) isn't propagated, use the
+// `baggage` propagator instead.
+//
+// SEE: https://www.jaegertracing.io/docs/latest/client-libraries/#propagation-format
+type JaegerPropagator struct{}
+
+// Inject satisfies the `propagation.TextMapPropagator` interface.
+func (JaegerPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	flags := 0
+
+	if sc.IsSampled() {
+		flags = jaegerSampled
+	}
+
+	// Parent span ID is deprecated, always "0".
+	carrier.Set(jaegerHeader, fmt.Sprintf("%s:%s:0:%x", sc.TraceID(), sc.SpanID(), flags))
+}
+
+// Extract satisfies the `propagation.TextMapPropagator` interface.
+func (JaegerPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	header, err := url.QueryUnescape(carrier.Get(jaegerHeader))
+	if err != nil {
+		return ctx
+	}
+
+	parts := strings.Split(header, ":")
+	if len(parts) != 4 {
+		return ctx
+	}
+
+	var flags int
+
+	if _, err := fmt.Sscanf(parts[3], "%x", &flags); err != nil {
+		return ctx
+	}
+
+	sampled := "0"
+
+	if flags&(jaegerSampled|jaegerDebug) != 0 {
+		sampled = "1"
+	}
+
+	return withRemoteSpanContext(ctx, parts[0], parts[1], sampled, false)
+}
+
+// Fields satisfies the `propagation.TextMapPropagator` interface.
+func (JaegerPropagator) Fields() []string {
+	return []string{jaegerHeader}
+}
+
+//////
+// Helpers.
+//////
+
+// Context key of the remote span context whose sampling decision is deferred
+// to the receiver.
+type deferredKey struct{}
+
+// Determines if the sampling decision of `parent`, the remote span context
+// stored in `ctx`, was deferred to the receiver.
+func isDeferred(ctx context.Context, parent trace.SpanContext) bool {
+	deferred, ok := ctx.Value(deferredKey{}).(trace.SpanContext)
+
+	return ok && deferred.Equal(parent)
+}
+
+// Returns the B3 sampling state of `sc`.
+func sampledFlag(sc trace.SpanContext) string {
+	if sc.IsSampled() {
+		return "1"
+	}
+
+	return "0"
+}
+
+// Left pads a hex encoded ID to `size` chars, e.g.: 64-bit trace IDs.
+func padID(id string, size int) string {
+	if len(id) >= size {
+		return id
+	}
+
+	return strings.Repeat("0", size-len(id)) + id
+}
+
+// Stores the remote span context described by the hex encoded `traceID`, and
+// `spanID` in `ctx`. `sampled` is "1", "true", or "d" (debug) if sampled, and
+// "" if the decision is deferred. If IDs are invalid, `ctx` is returned.
+func withRemoteSpanContext(ctx context.Context, traceID, spanID, sampled string, debug bool) context.Context {
+	if len(traceID) > 32 || len(spanID) > 16 {
+		return ctx
+	}
+
+	tid, err := trace.TraceIDFromHex(padID(strings.ToLower(traceID), 32))
+	if err != nil {
+		return ctx
+	}
+
+	sid, err := trace.SpanIDFromHex(padID(strings.ToLower(spanID), 16))
+	if err != nil {
+		return ctx
+	}
+
+	config := trace.SpanContextConfig{
+		TraceID: tid,
+		SpanID:  sid,
+		Remote:  true,
+	}
+
+	switch {
+	case debug || sampled == "1" || sampled == "true" || sampled == "d":
+		config.TraceFlags = trace.FlagsSampled
+	case sampled == "":
+		ctx = context.WithValue(ctx, deferredKey{}, trace.NewSpanContext(config))
+	}
+
+	return trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(config))
+}
+
+//////
+// Factory.
+//////
+
+// Propagators returns the propagators named `names`, e.g.: `tracecontext`,
+// `baggage`, `b3`, `b3multi`, and `jaeger`. Names are case-insensitive, and
+// can be comma-separated, so they can be selected from config, e.g.: the
+// `OTEL_PROPAGATORS` environment variable. Empty names are skipped.
+func Propagators(names ...string) ([]propagation.TextMapPropagator, error) {
+	propagators := []propagation.TextMapPropagator{}
+
+	for _, name := range strings.Split(strings.Join(names, ","), ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+			continue
+		case PropagatorTraceContext:
+			propagators = append(propagators, propagation.TraceContext{})
+		case PropagatorBaggage:
+			propagators = append(propagators, propagation.Baggage{})
+		case PropagatorB3:
+			propagators = append(propagators, B3Propagator{})
+		case PropagatorB3Multi:
+			propagators = append(propagators, B3MultiPropagator{})
+		case PropagatorJaeger:
+			propagators = append(propagators, JaegerPropagator{})
+		default:
+			return nil, customerror.NewInvalidError(fmt.Sprintf("propagator %s", name))
+		}
+	}
+
+	return propagators, nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPropagators(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+
+	for _, sampled := range []bool{true, false} {
+		sampled := sampled
+
+		config := trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}
+
+		if sampled {
+			config.TraceFlags = trace.FlagsSampled
+		}
+
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(config))
+
+		tests := []struct {
+			name    string
+			headers map[string]string
+		}{
+			{
+				name:    PropagatorTraceContext,
+				headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0"},
+			},
+			{
+				name:    PropagatorB3,
+				headers: map[string]string{"b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-"},
+			},
+			{
+				name: PropagatorB3Multi,
+				headers: map[string]string{
+					"X-B3-TraceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+					"X-B3-SpanId":  "00f067aa0ba902b7",
+				},
+			},
+			{
+				name:    PropagatorJaeger,
+				headers: map[string]string{"uber-trace-id": "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:"},
+			},
+		}
+
+		for _, tt := range tests {
+			tt := tt
+
+			t.Run(tt.name, func(t *testing.T) {
+				propagators, err := Propagators(tt.name)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				carrier := propagation.HeaderCarrier(http.Header{})
+
+				propagators[0].Inject(ctx, carrier)
+
+				// Values are prefixed by the IDs, and the sampling state.
+				for header, prefix := range tt.headers {
+					if got := carrier.Get(header); len(got) < len(prefix) || got[:len(prefix)] != prefix {
+						t.Errorf("Expected %s header prefixed by %q, got %q", header, prefix, got)
+					}
+				}
+
+				sc := trace.SpanContextFromContext(propagators[0].Extract(context.Background(), carrier))
+
+				if sc.TraceID() != traceID || sc.SpanID() != spanID {
+					t.Errorf("Expected %s-%s, got %s-%s", traceID, spanID, sc.TraceID(), sc.SpanID())
+				}
+
+				if sc.IsSampled() != sampled {
+					t.Errorf("Expected sampled %t, got %t", sampled, sc.IsSampled())
+				}
+
+				if !sc.IsRemote() {
+					t.Error("Expected a remote span context")
+				}
+			})
+		}
+	}
+
+	t.Run(PropagatorBaggage, func(t *testing.T) {
+		propagators, err := Propagators(PropagatorBaggage)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		member, err := baggage.NewMember("tenant", "acme")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := baggage.New(member)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		carrier := propagation.HeaderCarrier(http.Header{})
+
+		propagators[0].Inject(baggage.ContextWithBaggage(context.Background(), b), carrier)
+
+		extracted := baggage.FromContext(propagators[0].Extract(context.Background(), carrier))
+
+		if got := extracted.Member("tenant").Value(); got != "acme" {
+			t.Errorf("Expected tenant acme, got %q", got)
+		}
+	})
+}
+
+func TestPropagators_extract(t *testing.T) {
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		wantTraceID string
+		wantSampled bool
+	}{
+		{
+			name:        "b3 64-bit trace ID, debug",
+			headers:     map[string]string{"b3": "a3ce929d0e0e4736-00f067aa0ba902b7-d-5b4185666d50f68b"},
+			wantTraceID: "0000000000000000a3ce929d0e0e4736",
+			wantSampled: true,
+		},
+		{
+			name: "b3multi flags",
+			headers: map[string]string{
+				"X-B3-TraceId": "4BF92F3577B34DA6A3CE929D0E0E4736",
+				"X-B3-SpanId":  "00f067aa0ba902b7",
+				"X-B3-Flags":   "1",
+			},
+			wantTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantSampled: true,
+		},
+		{
+			name:        "jaeger URL encoded, debug",
+			headers:     map[string]string{"uber-trace-id": "a3ce929d0e0e4736%3Af067aa0ba902b7%3A0%3A2"},
+			wantTraceID: "0000000000000000a3ce929d0e0e4736",
+			wantSampled: true,
+		},
+		{
+			name:    "b3 sampling only",
+			headers: map[string]string{"b3": "0"},
+		},
+		{
+			name:    "jaeger malformed",
+			headers: map[string]string{"uber-trace-id": "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7"},
+		},
+	}
+
+	propagators, err := Propagators("b3, B3Multi", "jaeger")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	propagator := propagation.NewCompositeTextMapPropagator(propagators...)
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			carrier := propagation.HeaderCarrier(http.Header{})
+
+			for k, v := range tt.headers {
+				carrier.Set(k, v)
+			}
+
+			sc := trace.SpanContextFromContext(propagator.Extract(context.Background(), carrier))
+
+			if tt.wantTraceID == "" {
+				if sc.IsValid() {
+					t.Fatalf("Expected no span context, got %s", sc.TraceID())
+				}
+
+				return
+			}
+
+			if sc.TraceID().String() != tt.wantTraceID {
+				t.Errorf("Expected trace ID %s, got %s", tt.wantTraceID, sc.TraceID())
+			}
+
+			if sc.IsSampled() != tt.wantSampled {
+				t.Errorf("Expected sampled %t, got %t", tt.wantSampled, sc.IsSampled())
+			}
+		})
+	}
+
+	if _, err := Propagators("zipkin"); err == nil {
+		t.Fatal("Expected error for unknown propagator")
+	}
+}
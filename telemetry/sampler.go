@@ -0,0 +1,120 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package telemetry
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//////
+// Samplers.
+//////
+
+// RatioSampler samples a `ratio` (0..1) of traces, e.g.: `0.1` samples 10%.
+// The decision is made from the trace ID, so it's consistent across services.
+func RatioSampler(ratio float64) sdktrace.Sampler {
+	return sdktrace.TraceIDRatioBased(ratio)
+}
+
+// ParentBasedSampler follows the parent span decision, if any, otherwise
+// `root` decides, e.g.: `ParentBasedSampler(RatioSampler(0.1))`. `root` also
+// decides if the remote parent deferred the decision, e.g.: B3 headers
+// without the sampling state.
+func ParentBasedSampler(root sdktrace.Sampler) sdktrace.Sampler {
+	return &parentBasedSampler{
+		parentBased: sdktrace.ParentBased(root),
+		root:        root,
+	}
+}
+
+// Parent based sampler, aware of deferred decisions.
+type parentBasedSampler struct {
+	parentBased sdktrace.Sampler
+	root        sdktrace.Sampler
+}
+
+// ShouldSample satisfies the `sdktrace.Sampler` interface.
+func (s *parentBasedSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if isDeferred(p.ParentContext, trace.SpanContextFromContext(p.ParentContext)) {
+		return s.root.ShouldSample(p)
+	}
+
+	return s.parentBased.ShouldSample(p)
+}
+
+// Description satisfies the `sdktrace.Sampler` interface.
+func (s *parentBasedSampler) Description() string {
+	return s.parentBased.Description()
+}
+
+// RateLimitedSampler samples up to `perSecond` traces per second, bursts up
+// to the same amount are allowed.
+//
+// NOTE: Use `ParentBasedSampler(RateLimitedSampler(n))` to only limit roots.
+func RateLimitedSampler(perSecond float64) sdktrace.Sampler {
+	return &rateLimitedSampler{
+		max:       math.Max(perSecond, 1),
+		now:       time.Now,
+		perSecond: perSecond,
+		tokens:    math.Max(perSecond, 1),
+	}
+}
+
+// Token bucket sampler.
+type rateLimitedSampler struct {
+	last      time.Time
+	m         sync.Mutex
+	max       float64
+	now       func() time.Time
+	perSecond float64
+	tokens    float64
+}
+
+// Takes a token, if available.
+func (s *rateLimitedSampler) take() bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := s.now()
+
+	if !s.last.IsZero() {
+		s.tokens = math.Min(s.max, s.tokens+now.Sub(s.last).Seconds()*s.perSecond)
+	}
+
+	s.last = now
+
+	if s.tokens < 1 {
+		return false
+	}
+
+	s.tokens--
+
+	return true
+}
+
+// ShouldSample satisfies the `sdktrace.Sampler` interface.
+func (s *rateLimitedSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := sdktrace.SamplingResult{
+		Decision:   sdktrace.Drop,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+
+	if s.perSecond > 0 && s.take() {
+		result.Decision = sdktrace.RecordAndSample
+	}
+
+	return result
+}
+
+// Description satisfies the `sdktrace.Sampler` interface.
+func (s *rateLimitedSampler) Description() string {
+	return fmt.Sprintf("RateLimitedSampler{%g}", s.perSecond)
+}
@@ -5,10 +5,13 @@
 package telemetry
 
 import (
+	"context"
 	"sync"
 
+	"github.com/thalesfsp/customerror"
 	"go.opentelemetry.io/otel"
 	stdout "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
@@ -20,6 +23,9 @@ import (
 
 const globalTracerName = "global"
 
+// Propagators used if none is named.
+var defaultPropagators = []string{PropagatorTraceContext, PropagatorBaggage}
+
 //////
 // Helpers.
 //////
@@ -39,12 +45,30 @@ func initializeStdoutProvider() (*sdktrace.TracerProvider, error) {
 	return stdoutProvider, nil
 }
 
+// Returns the propagators named `names`, or the default ones if none is, e.g.:
+// an unset `OTEL_PROPAGATORS` environment variable.
+func propagatorsOrDefault(names []string) ([]propagation.TextMapPropagator, error) {
+	propagators, err := Propagators(names...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(propagators) == 0 {
+		return Propagators(defaultPropagators...)
+	}
+
+	return propagators, nil
+}
+
 //////
 // Interface.
 //////
 
 // ITelemetry defines what a Telemetry does.
 type ITelemetry interface {
+	// ForceFlush exports ended spans which weren't exported yet.
+	ForceFlush(ctx context.Context) error
+
 	// GetGlobalTracer returns the global tracer.
 	GetGlobalTracer() trace.Tracer
 
@@ -54,6 +78,10 @@ type ITelemetry interface {
 
 	// NewTracer creates a tracer from the current provider.
 	NewTracer(name string) trace.Tracer
+
+	// Shutdown flushes, and stops the provider. Spans ended after it are
+	// dropped.
+	Shutdown(ctx context.Context) error
 }
 
 //////
@@ -67,6 +95,12 @@ type Telemetry struct {
 	// SEE: https://opentelemetry.io/docs/instrumentation/go/exporting_data/
 	Provider trace.TracerProvider
 
+	// MeterProvider, if set, and metrics are enabled, exposes the server
+	// metrics through the same OpenTelemetry pipeline, default: none.
+	//
+	// SEE: `metric.NewOTelBridge`.
+	MeterProvider metric.MeterProvider
+
 	// TextMapPropagator propagates cross-cutting concerns as key-value text.
 	//
 	// SEE: // SEE: https://opentelemetry.io/docs/instrumentation/go/manual/#propagators-and-context
@@ -111,6 +145,36 @@ func (t *Telemetry) GetGlobalTracer() trace.Tracer {
 	return t.GetTracer(globalTracerName)
 }
 
+// ForceFlush exports ended spans which weren't exported yet. It's a no-op if
+// the provider doesn't batch spans.
+func (t *Telemetry) ForceFlush(ctx context.Context) error {
+	p, ok := t.Provider.(interface{ ForceFlush(context.Context) error })
+	if !ok {
+		return nil
+	}
+
+	if err := p.ForceFlush(ctx); err != nil {
+		return customerror.NewFailedToError("flush telemetry", customerror.WithError(err))
+	}
+
+	return nil
+}
+
+// Shutdown flushes, and stops the provider. Spans ended after it are dropped.
+// It's a no-op if the provider can't be stopped.
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	p, ok := t.Provider.(interface{ Shutdown(context.Context) error })
+	if !ok {
+		return nil
+	}
+
+	if err := p.Shutdown(ctx); err != nil {
+		return customerror.NewFailedToError("shutdown telemetry", customerror.WithError(err))
+	}
+
+	return nil
+}
+
 //////
 // Factory.
 //////
@@ -126,7 +190,8 @@ func New(
 		TextMapPropagator: textMapPropagators,
 	}
 
-	telemetry.tracers.Store(globalTracerName, otel.Tracer(name))
+	// From the provider, not the global one, so telemetries are isolated.
+	telemetry.tracers.Store(globalTracerName, telemetry.Provider.Tracer(name))
 
 	otel.SetTracerProvider(telemetry.Provider)
 
@@ -136,8 +201,16 @@ func New(
 }
 
 // StdoutProvider returns a telemetry which exports to `stdout`, and samples
-// every trace.
-func StdoutProvider(name string) (*Telemetry, error) {
+// every trace. Context is propagated by the `propagators` named, default:
+// `tracecontext`, and `baggage`.
+//
+// SEE: `Propagators`.
+func StdoutProvider(name string, propagators ...string) (*Telemetry, error) {
+	textMapPropagators, err := propagatorsOrDefault(propagators)
+	if err != nil {
+		return nil, err
+	}
+
 	stdoutProvider, err := initializeStdoutProvider()
 	if err != nil {
 		return nil, err
@@ -146,6 +219,6 @@ func StdoutProvider(name string) (*Telemetry, error) {
 	return New(
 		name,
 		stdoutProvider,
-		propagation.TraceContext{}, propagation.Baggage{},
+		textMapPropagators...,
 	)
 }
@@ -0,0 +1,44 @@
+// Copyright 2021 The webserver Authors. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTelemetry_Shutdown_noop(t *testing.T) {
+	// Providers which don't batch spans have nothing to flush.
+	telemetry, err := New("test-service", trace.NewNoopTracerProvider())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := telemetry.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := telemetry.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_propagatorsOrDefault(t *testing.T) {
+	// E.g.: an unset `OTEL_PROPAGATORS`.
+	propagators, err := propagatorsOrDefault([]string{""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(propagators) != len(defaultPropagators) {
+		t.Fatalf("Expected the default propagators, got %v", propagators)
+	}
+
+	if _, err := propagatorsOrDefault([]string{"zipkin"}); err == nil {
+		t.Fatal("Expected error for unknown propagator")
+	}
+}
@@ -6,18 +6,121 @@ package webserver
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/thalesfsp/customerror"
 	handler "github.com/thalesfsp/webserver/handler"
+	"github.com/thalesfsp/webserver/internal/certificate"
+	"github.com/thalesfsp/webserver/metric"
 )
 
-// Adds a `Handler` to a `Router`.
-func addHandler(router *mux.Router, handlers ...handler.Handler) {
-	for _, handler := range handlers {
-		router.HandleFunc(handler.Path, handler.Handler).Methods(handler.Method)
+// Adds a `Handler` to the server router, recording its settings.
+func (s *Server) addHandler(handlers ...handler.Handler) {
+	for _, h := range handlers {
+		route := s.GetRouter().HandleFunc(h.Path, h.Handler).Methods(h.Method)
+
+		s.routes.Store(route, h)
+	}
+}
+
+// Returns the `Handler` of the route matching `r`, if any.
+func (s *Server) routeHandler(r *http.Request) (handler.Handler, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return handler.Handler{}, false
 	}
+
+	h, ok := s.routes.Load(route)
+	if !ok {
+		return handler.Handler{}, false
+	}
+
+	hh, ok := h.(handler.Handler)
+
+	return hh, ok
+}
+
+// Returns the timeout of the route matching `r`, or the default one.
+// Streaming routes have no timeout.
+func (s *Server) routeTimeout(r *http.Request) time.Duration {
+	if h, ok := s.routeHandler(r); ok {
+		if h.Streaming {
+			return handler.NoTimeout
+		}
+
+		if h.Timeout != 0 {
+			return h.Timeout
+		}
+	}
+
+	return s.Timeout.RequestTimeout
+}
+
+// Stops the server, as requested by the `Stop` handler.
+func (s *Server) stopFromRequest(hard bool) error {
+	if hard {
+		return s.Stop(os.Kill)
+	}
+
+	return s.Stop(os.Interrupt)
+}
+
+// Stores the server stop function in the request context, so the `Stop`
+// handler stops this server.
+func (s *Server) withStop(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(handler.ContextWithStop(r.Context(), s.stopFromRequest)))
+	})
+}
+
+// Determines if the server isn't running startup hooks.
+func (s *Server) isStarted() bool {
+	return !s.warmingUp.Load()
+}
+
+// Determines if the route matching `r` is a probe.
+func (s *Server) isProbe(r *http.Request) bool {
+	h, ok := s.routeHandler(r)
+
+	return ok && h.Probe
+}
+
+// Determines if the route matching `r` is streaming.
+func (s *Server) isStreaming(r *http.Request) bool {
+	h, ok := s.routeHandler(r)
+
+	return ok && h.Streaming
+}
+
+// Creates the StatsD exporter of `registries`, flushing it one last time
+// during the shutdown task phase.
+func (s *Server) setupStatsD(registries []*metric.Registry) error {
+	// Registries set by the caller take precedence.
+	opts := append([]metric.StatsDOption{metric.WithStatsDRegistries(registries...)}, s.statsdOptions...)
+
+	exporter, err := metric.NewStatsDExporter(s.statsdAddress, opts...)
+	if err != nil {
+		return err
+	}
+
+	s.statsd = exporter
+
+	// Closed once flushed, it connects again on the next start.
+	return s.RegisterShutdownTask("statsd flush", flushShutdownTaskPriority, func(ctx context.Context) error {
+		flushErr := exporter.Flush()
+
+		if err := exporter.Close(); err != nil && flushErr == nil {
+			return customerror.NewFailedToError("close StatsD exporter", customerror.WithError(err))
+		}
+
+		return flushErr
+	})
 }
 
 // Verifies is `err` is a timeout.
@@ -30,3 +133,57 @@ func isTimeoutError(err error) bool {
 
 	return false
 }
+
+// Loads a PEM encoded CA bundle from `path`.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, customerror.NewFailedToError("read CA bundle", customerror.WithError(err))
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, customerror.NewInvalidError("CA bundle, no certificate found")
+	}
+
+	return pool, nil
+}
+
+// Builds the TLS configuration from `t`. If certificate, and key files are
+// set, a reloader serving them is returned. Returns `nil` if TLS isn't enabled.
+func buildTLSConfig(t *TLS) (*tls.Config, *certificate.Reloader, error) {
+	if t == nil {
+		return nil, nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if t.Config != nil {
+		tlsConfig = t.Config.Clone()
+	}
+
+	if t.ClientCAFile != "" {
+		clientCAs, err := loadCertPool(t.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if t.CertFile == "" {
+		return tlsConfig, nil, nil
+	}
+
+	reloader, err := certificate.New(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig.Certificates = nil
+	tlsConfig.GetCertificate = reloader.GetCertificate
+
+	return tlsConfig, reloader, nil
+}
@@ -6,9 +6,12 @@ package webserver
 
 import (
 	"context"
+	"crypto/tls"
+	"math"
 	"net/http"
 	"os"
-	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -23,6 +26,8 @@ import (
 	"github.com/thalesfsp/webserver/metric"
 	"github.com/thalesfsp/webserver/telemetry"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 //////
@@ -30,16 +35,33 @@ import (
 //////
 
 const (
-	defaultTimeout             = 3 * time.Second
-	defaultRequestTimeout      = 1 * time.Second
-	defaultShutdownTaskTimeout = 10 * time.Second
-	frameworkName              = "webserver"
+	defaultCertificateReloadInterval = 10 * time.Second
+	defaultTimeout                   = 3 * time.Second
+	defaultRequestTimeout            = 1 * time.Second
+	defaultShutdownTaskTimeout       = 10 * time.Second
+	defaultSpanIDHeader              = "X-Span-Id"
+	defaultTraceIDHeader             = "X-Trace-Id"
+	frameworkName                    = "webserver"
+
+	// Flush tasks run last, so metrics, and spans recorded by other tasks
+	// are included.
+	flushShutdownTaskPriority = math.MaxInt
 )
 
-// ErrRequesTimeout indicates a request failed to finish, it timed out.
+// Catchable OS signals handled by `Start`, forget SIGKILL...
+var defaultSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// ErrStarting indicates a request arrived before startup hooks completed.
+var ErrStarting = customerror.NewFailedToError(
+	"serve request, server is starting",
+	customerror.WithStatusCode(http.StatusServiceUnavailable),
+)
+
+// ErrRequesTimeout indicates a request failed to finish, it timed out. As
+// Go's `http.TimeoutHandler`, it replies with `503`.
 var ErrRequesTimeout = customerror.NewFailedToError(
 	"finish request, timed out",
-	customerror.WithStatusCode(http.StatusRequestTimeout),
+	customerror.WithStatusCode(http.StatusServiceUnavailable),
 )
 
 //////
@@ -48,16 +70,35 @@ var ErrRequesTimeout = customerror.NewFailedToError(
 
 // IServer defines what a server does.
 type IServer interface {
+	// GetHub returns the WebSocket connections hub.
+	GetHub() *handler.Hub
+
 	// GetLogger returns the server logger.
 	GetLogger() sypl.ISypl
 
+	// GetRegistry returns the server metrics registry.
+	GetRegistry() *metric.Registry
+
 	// GetRouter returns the server router.
 	GetRouter() *mux.Router
 	GetTelemetry() telemetry.ITelemetry
 
-	// Start the server.
+	// NewHTTPClient returns an instrumented client to call other services.
+	NewHTTPClient(opts ...ClientOption) *http.Client
+
+	// RegisterShutdownTask registers a task which runs during shutdown.
+	RegisterShutdownTask(name string, priority int, fn ShutdownTaskFunc) error
+
+	// Shutdown gracefully shuts down the server, and waits for it.
+	Shutdown(ctx context.Context) (*ShutdownResult, error)
+
+	// Start the server, and blocks until it's stopped. OS signals are handled.
 	Start() error
 
+	// StartContext starts the server, and blocks until it's stopped, or `ctx`
+	// is done.
+	StartContext(ctx context.Context) (*ShutdownResult, error)
+
 	// Stop the server.
 	Stop(sig os.Signal) error
 }
@@ -85,32 +126,101 @@ type Timeout struct {
 	ReadTimeout time.Duration `json:"read_timeout"`
 
 	// RequestTimeout max duration to WAIT BEFORE CANCELING A REQUEST,
-	// default: 1s.
+	// default: 1s. Handlers can override it.
+	//
+	// SEE: `handler.Handler.Timeout`.
 	//
 	// NOTE: It's automatically validated against other timeouts, and needs to
 	// be smaller.
 	RequestTimeout time.Duration `json:"request_timeout" validate:"ltfield=ReadTimeout"`
 
+	// ShutdownDrainPeriod max duration to KEEP SERVING after the server is
+	// marked as not ready, and before in-flight requests are drained. It gives
+	// load balancers time to stop routing traffic, default: 0s.
+	ShutdownDrainPeriod time.Duration `json:"shutdown_drain_period"`
+
 	// ShutdownInFlightTimeout max duration to WAIT IN-FLIGHT REQUESTS,
 	// default: 3s.
 	ShutdownInFlightTimeout time.Duration `json:"shutdown_in_flight_timeout"`
 
-	// ShutdownTaskTimeout max duration TO WAIT for tasks such as flush cache,
-	// files, and telemetry, default: 10s.
+	// ShutdownTaskTimeout is the deadline for shutdown tasks such as flush
+	// cache, files, and telemetry, default: 10s.
+	//
+	// SEE: `RegisterShutdownTask`.
 	ShutdownTaskTimeout time.Duration `json:"shutdown_task_timeout"`
 
 	// ShutdownTimeout max duration for WRITING the response, default: 3s.
 	WriteTimeout time.Duration `json:"write_timeout"`
 }
 
+// TLS settings. Certificate, and key files take precedence over the
+// certificates in `Config`.
+type TLS struct {
+	// CertFile is the path to the PEM encoded certificate, default: "".
+	CertFile string `json:"cert_file" validate:"required_without=Config,required_with=KeyFile,omitempty,file"`
+
+	// KeyFile is the path to the PEM encoded private key, default: "".
+	KeyFile string `json:"key_file" validate:"required_with=CertFile,omitempty,file"`
+
+	// ReloadInterval is how often certificate, and key files are checked for
+	// changes. Changed files are reloaded without restarting the server,
+	// default: 10s.
+	ReloadInterval time.Duration `json:"reload_interval" validate:"required_with=CertFile"`
+
+	// ClientCAFile is the path to the PEM encoded CA bundle used to verify
+	// client certificates. If set, clients are required to present a valid
+	// certificate (mTLS), default: "".
+	ClientCAFile string `json:"client_ca_file" validate:"omitempty,file"`
+
+	// Config is the base TLS configuration, default: none.
+	Config *tls.Config `json:"-"`
+}
+
+// Tracing settings. Response headers carrying the IDs of the request span,
+// set if telemetry is enabled.
+type Tracing struct {
+	// TraceIDHeader is the response header carrying the trace ID. Set to ""
+	// to disable, default: "X-Trace-Id".
+	TraceIDHeader string `json:"trace_id_header"`
+
+	// SpanIDHeader is the response header carrying the span ID. Set to "" to
+	// disable, default: "X-Span-Id".
+	SpanIDHeader string `json:"span_id_header"`
+
+	// EchoTraceparent controls whether the W3C `traceparent` header is also
+	// set, or not, default: true.
+	EchoTraceparent bool `json:"echo_traceparent"`
+
+	// Propagators are the names of the propagators of the default telemetry,
+	// e.g.: "b3", default: "tracecontext", and "baggage".
+	//
+	// SEE: `telemetry.Propagators`.
+	Propagators []string `json:"propagators"`
+
+	// ShutdownProvider controls whether the telemetry provider is also
+	// shutdown, after it's flushed, once other shutdown tasks finished, or
+	// not. A shutdown provider drops spans, so turn it off if the server
+	// restarts, or the telemetry is shared, default: true.
+	ShutdownProvider bool `json:"shutdown_provider"`
+}
+
 // Server definition.
 type Server struct {
 	// Address is a TCP address to listen on.
 	Address string `json:"address" validate:"required,hostname_port"`
 
+	// EnableGlobalMetrics controls whether metrics published in the
+	// package-level registry (e.g.: via `metric.Publish`) are also served, or
+	// not, default: true.
+	EnableGlobalMetrics bool `json:"enable_global_metrics"`
+
 	// EnableMetrics controls whether metrics are enable, or not, default: false.
 	EnableMetrics bool `json:"enable_metrics"`
 
+	// EnablePrometheus controls whether metrics are also served in the
+	// Prometheus text format, or not, default: false.
+	EnablePrometheus bool `json:"enable_prometheus"`
+
 	// EnableTelemetry controls whether telemetry are enable, or not,
 	// default: false.
 	EnableTelemetry bool `json:"enable_telemetry"`
@@ -124,25 +234,84 @@ type Server struct {
 	// Timeouts fine-control.
 	*Timeout `json:"timeout" validate:"required"`
 
+	// TLS enables HTTPS, default: none.
+	*TLS `json:"tls,omitempty" validate:"omitempty"`
+
+	// Tracing fine-control.
+	*Tracing `json:"tracing" validate:"required"`
+
+	// RED metrics of clients created via `NewHTTPClient`, default: none.
+	clientMetrics *middleware.HTTPClientMetrics `json:"-"`
+
 	// Handlers added, and configured before the server starts, default: none.
 	handlers []handler.Handler `json:"-"`
 
+	// WebSocket connections, closed during the shutdown.
+	hub *handler.Hub `json:"-" validate:"required"`
+
+	// Lifecycle of the running server.
+	lifecycle *lifecycle `json:"-"`
+
+	// Guards `lifecycle`.
+	lifecycleMutex sync.Mutex `json:"-"`
+
 	// Logger powered by Sypl.
 	logger *sypl.Sypl `json:"-" validate:"required"`
 
+	// Exposes metrics through OpenTelemetry, default: none.
+	meterProvider otelmetric.MeterProvider `json:"-"`
+
 	// Metrics added, and configured before the server starts, default: none.
 	metrics []metric.Metric `json:"-"`
 
+	// Bridges metrics to `meterProvider`, default: none.
+	otelBridge *metric.OTelBridge `json:"-"`
+
 	// Readiness determiners added, and configured before the server starts,
 	// default: none.
 	readinessDeterminers []*handler.ReadinessDeterminer `json:"-"`
 
+	// Metrics registry of the server.
+	registry *metric.Registry `json:"-" validate:"required"`
+
 	// Router powered by Gorilla Mux.
 	router *mux.Router `json:"-" validate:"required"`
 
+	// Handlers settings (e.g.: timeout) per route.
+	routes sync.Map `json:"-"`
+
+	// Startup hooks, run in order when the server starts, default: none.
+	startupHooks []StartupHook `json:"-"`
+
+	// Ready once all startup hooks completed.
+	startupDeterminer *handler.ReadinessDeterminer `json:"-"`
+
+	// Set while startup hooks run, only probes are served meanwhile.
+	warmingUp atomic.Bool `json:"-"`
+
+	// Not ready once the shutdown begins.
+	shutdownDeterminer *handler.ReadinessDeterminer `json:"-"`
+
+	// Tasks which run during the shutdown, default: none.
+	shutdownTasks []shutdownTask `json:"-"`
+
+	// Guards `shutdownTasks`.
+	shutdownTasksMutex sync.Mutex `json:"-"`
+
+	// OS signals which trigger graceful shutdown, default: none for
+	// `StartContext`, `os.Interrupt`, and `syscall.SIGTERM` for `Start`.
+	signals []os.Signal `json:"-"`
+
 	// HTTP server powered by Golang's built-in http server.
 	server http.Server `json:"-" validate:"required"`
 
+	// Pushes metrics to StatsD while the server is running, default: none.
+	statsd *metric.StatsDExporter `json:"-"`
+
+	// StatsD server UDP address, and exporter options, default: none.
+	statsdAddress string                `json:"-"`
+	statsdOptions []metric.StatsDOption `json:"-"`
+
 	// Telemetry powered by OpenTelemetry, default: none.
 	telemetry telemetry.ITelemetry `json:"-"`
 }
@@ -151,11 +320,23 @@ type Server struct {
 // IServer implementation.
 //////
 
+// GetHub returns the WebSocket connections hub. Use it with
+// `handler.WebSocket`, so connections are closed during the shutdown.
+func (s *Server) GetHub() *handler.Hub {
+	return s.hub
+}
+
 // GetLogger returns the server logger.
 func (s *Server) GetLogger() sypl.ISypl {
 	return s.logger
 }
 
+// GetRegistry returns the server metrics registry. Use it to publish your own
+// metrics.
+func (s *Server) GetRegistry() *metric.Registry {
+	return s.registry
+}
+
 // GetRouter returns the server base router. Use it do add your own handlers.
 func (s *Server) GetRouter() *mux.Router {
 	return s.router
@@ -166,100 +347,72 @@ func (s *Server) GetTelemetry() telemetry.ITelemetry {
 	return s.telemetry
 }
 
-// Start the server.
+// Start the server, and blocks until it's stopped. It gracefully shuts down
+// when receiving `os.Interrupt`, or `syscall.SIGTERM` - or the signals set via
+// `WithSignals`. Once gracefully shutdown, `http.ErrServerClosed` is returned.
 func (s *Server) Start() error {
-	// Instantiates the underlying HTTP server.
-	s.server = http.Server{
-		Addr: s.Address,
-		Handler: http.TimeoutHandler(
-			s.GetRouter(),
-			s.Timeout.RequestTimeout,
-			ErrRequesTimeout.Error(),
-		),
+	signals := s.signals
 
-		// Best practice setting timeouts. It avoid "slowloris" attacks.
-		ReadTimeout:  s.Timeout.ReadTimeout,
-		WriteTimeout: s.Timeout.WriteTimeout,
+	if len(signals) == 0 {
+		signals = defaultSignals
 	}
 
-	serverErr := make(chan error, 1)
-
-	// Non-blocking server start up.
-	go func() {
-		s.GetLogger().Debuglnf("server is about to start @ %s", s.Address)
-		serverErr <- s.server.ListenAndServe()
-	}()
-
-	// Listen for "catchable" OS signals, forget SIGKILL...
-	osSignals := make(chan os.Signal, 1)
-	signal.Notify(osSignals, os.Interrupt, syscall.SIGTERM)
-
-	// Block execution, and listen for any server errors (e.g.: "port in use"),
-	// or OS signals.
-	select {
-	// These errors don't require graceful shutdown.
-	case err := <-serverErr:
+	if _, err := s.start(context.Background(), signals); err != nil {
 		return err
-	case sig := <-osSignals:
-		const crtlCmsg = "press ctrl+c to stop anyway"
-
-		s.logger.PrintNewLine()
-		s.GetLogger().Tracelnf("Got %s signal, gracefully shutting down", sig)
-		s.GetLogger().Tracelnf("Waiting %s for inflight requests to finish, %s", s.ShutdownInFlightTimeout, crtlCmsg)
-
-		// Let Go terminate the program if we get that signal again.
-		signal.Reset(sig)
-
-		ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownInFlightTimeout)
-		defer cancel()
-
-		var shutdownErr error
-
-		s.server.SetKeepAlivesEnabled(false)
-
-		// Attempt to gracefully shutdown by closing the listener, waiting the
-		// completion of all inflight requests.
-		if err := s.server.Shutdown(ctx); err != nil {
-			if isTimeoutError(shutdownErr) {
-				shutdownErr = customerror.NewFailedToError(
-					"gracefully shutdown, timeout reached. Stopping hard...",
-					customerror.WithError(err),
-				)
-			} else {
-				shutdownErr = err
-			}
+	}
 
-			// Well.. KIH: Kill It Hard.
-			if err := s.server.Close(); err != nil {
-				shutdownErr = customerror.NewFailedToError(
-					"hardly shutdown the server",
-					customerror.WithError(err),
-				)
-			}
-		}
+	return http.ErrServerClosed
+}
 
-		if shutdownErr != nil {
-			return shutdownErr
-		}
+// StartContext starts the server, and blocks until it's stopped. It gracefully
+// shuts down when `ctx` is done, `Shutdown`, or `Stop` is called. OS signals
+// are only handled if set via `WithSignals`.
+func (s *Server) StartContext(ctx context.Context) (*ShutdownResult, error) {
+	return s.start(ctx, s.signals)
+}
 
-		// Wait for tasks such as flush cache and files, and telemetry.
-		s.GetLogger().Tracelnf("Waiting %s for tasks, %s", s.ShutdownTaskTimeout, crtlCmsg)
+// Shutdown gracefully shuts down the server, and waits for it. `ctx` bounds
+// the whole shutdown, if it's done before in-flight requests finish, the
+// server is hard stopped.
+func (s *Server) Shutdown(ctx context.Context) (*ShutdownResult, error) {
+	l, err := s.getLifecycle()
+	if err != nil {
+		return nil, err
+	}
 
-		time.Sleep(s.ShutdownTaskTimeout)
+	l.request(shutdownRequest{
+		cause: ShutdownCauseShutdown,
+		ctx:   ctx,
+	})
 
-		// If reaches here, error can be safely collected.
-		return <-serverErr
+	select {
+	case <-l.done:
+		return l.result, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
-// Stop the server.
+// Stop the server without waiting for it. `os.Kill` immediately stops it, any
+// other signal gracefully shuts it down.
+//
+// NOTE: No OS signal is sent, other servers in the same process are unaffected.
+// Unlike previous versions, which signaled the process, it fails if the server
+// was never started.
 func (s *Server) Stop(sig os.Signal) error {
-	p, err := os.FindProcess(os.Getpid())
+	l, err := s.getLifecycle()
 	if err != nil {
 		return err
 	}
 
-	return p.Signal(sig)
+	l.request(shutdownRequest{
+		cause:  ShutdownCauseStop,
+		ctx:    context.Background(),
+		hard:   sig == os.Kill,
+		signal: sig,
+	})
+
+	return nil
 }
 
 //////
@@ -273,10 +426,12 @@ func (s *Server) Stop(sig os.Signal) error {
 // - pre-loaded handlers (Liveness, OK, and Stop).
 func New(name, address string, opts ...Option) (IServer, error) {
 	s := &Server{
-		Address:         address,
-		EnableMetrics:   false,
-		EnableTelemetry: false,
-		Name:            name,
+		Address:             address,
+		EnableGlobalMetrics: true,
+		EnableMetrics:       false,
+		EnablePrometheus:    false,
+		EnableTelemetry:     false,
+		Name:                name,
 		Logging: &Logging{
 			ConsoleLevel: level.None.String(),
 			RequestLevel: level.None.String(),
@@ -285,14 +440,25 @@ func New(name, address string, opts ...Option) (IServer, error) {
 		Timeout: &Timeout{
 			ReadTimeout:             defaultTimeout,
 			RequestTimeout:          defaultRequestTimeout,
+			ShutdownDrainPeriod:     0,
 			ShutdownInFlightTimeout: defaultTimeout,
 			ShutdownTaskTimeout:     defaultShutdownTaskTimeout,
 			WriteTimeout:            defaultTimeout,
 		},
+		Tracing: &Tracing{
+			TraceIDHeader:    defaultTraceIDHeader,
+			SpanIDHeader:     defaultSpanIDHeader,
+			EchoTraceparent:  true,
+			ShutdownProvider: true,
+		},
 
-		handlers: []handler.Handler{},
-		metrics:  []metric.Metric{},
-		router:   mux.NewRouter(),
+		handlers:           []handler.Handler{},
+		hub:                handler.NewHub(),
+		registry:           metric.NewRegistry(),
+		metrics:            []metric.Metric{},
+		router:             mux.NewRouter(),
+		shutdownDeterminer: handler.NewReadinessDeterminer(shutdownDeterminerName),
+		startupDeterminer:  handler.NewReadinessDeterminer(startupDeterminerName),
 	}
 
 	//////
@@ -314,7 +480,14 @@ func New(name, address string, opts ...Option) (IServer, error) {
 		s.Logging.Filepath,
 	).New(name)
 
-	s.GetRouter().Use(middleware.Logger(s.logger))
+	// The `Stop` handler stops this server, not the process.
+	s.GetRouter().Use(s.withStop)
+
+	// Client identity is extracted before logging, so it's part of the
+	// access log.
+	if s.TLS != nil && s.TLS.ClientCAFile != "" {
+		s.GetRouter().Use(middleware.ClientIdentity())
+	}
 
 	//////
 	// Telemetry.
@@ -322,7 +495,7 @@ func New(name, address string, opts ...Option) (IServer, error) {
 
 	if s.EnableTelemetry {
 		if s.GetTelemetry() == nil {
-			defaultTelemetry, err := telemetry.StdoutProvider(name)
+			defaultTelemetry, err := telemetry.StdoutProvider(name, s.Propagators...)
 			if err != nil {
 				return nil, err
 			}
@@ -330,9 +503,96 @@ func New(name, address string, opts ...Option) (IServer, error) {
 			s.telemetry = defaultTelemetry
 		}
 
-		s.GetRouter().Use(otelmux.Middleware(name))
+		// Spans are created, and propagated by the server telemetry, not the
+		// global one.
+		var otelmuxOptions []otelmux.Option
+
+		if t, ok := s.GetTelemetry().(*telemetry.Telemetry); ok {
+			if t.Provider != nil {
+				otelmuxOptions = append(otelmuxOptions, otelmux.WithTracerProvider(t.Provider))
+			}
+
+			if len(t.TextMapPropagator) > 0 {
+				otelmuxOptions = append(otelmuxOptions, otelmux.WithPropagators(
+					propagation.NewCompositeTextMapPropagator(t.TextMapPropagator...),
+				))
+			}
+		}
+
+		s.GetRouter().Use(
+			otelmux.Middleware(name, otelmuxOptions...),
+			middleware.TraceHeaders(s.TraceIDHeader, s.SpanIDHeader, s.EchoTraceparent),
+		)
+
+		// Batched spans are exported before the process exits, including
+		// the ones of other shutdown tasks.
+		if err := s.RegisterShutdownTask("telemetry flush", flushShutdownTaskPriority, s.GetTelemetry().ForceFlush); err != nil {
+			return nil, err
+		}
+
+		// Stops batch span processors, and exporters.
+		if s.ShutdownProvider {
+			if err := s.RegisterShutdownTask("telemetry shutdown", flushShutdownTaskPriority, s.GetTelemetry().Shutdown); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Logged after telemetry, so requests are logged with their trace, and
+	// span IDs.
+	s.GetRouter().Use(
+		middleware.RequestLogger(s.logger),
+		middleware.Logger(s.logger),
+	)
+
+	//////
+	// Metrics.
+	//////
+
+	// Outside of the timeout middleware, so timeouts are accounted.
+	if s.EnableMetrics {
+		httpMetrics, err := middleware.NewHTTPMetrics(s.registry)
+		if err != nil {
+			return nil, err
+		}
+
+		s.GetRouter().Use(middleware.Metrics(httpMetrics))
+
+		// Router middlewares only run for matched routes, so unmatched ones
+		// (`404`, and `405`) are recorded by their handlers.
+		router := s.GetRouter()
+
+		notFound, methodNotAllowed := router.NotFoundHandler, router.MethodNotAllowedHandler
+
+		if notFound == nil {
+			notFound = http.NotFoundHandler()
+		}
+
+		if methodNotAllowed == nil {
+			methodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			})
+		}
+
+		router.NotFoundHandler = middleware.Metrics(httpMetrics)(notFound)
+		router.MethodNotAllowedHandler = middleware.Metrics(httpMetrics)(methodNotAllowed)
+
+		clientMetrics, err := middleware.NewHTTPClientMetrics(s.registry)
+		if err != nil {
+			return nil, err
+		}
+
+		s.clientMetrics = clientMetrics
 	}
 
+	// Only probes are served until startup hooks complete. Inside logging, and
+	// metrics, so warm-up replies are logged, and counted.
+	s.GetRouter().Use(middleware.Starting(s.isStarted, s.isProbe, ErrStarting))
+
+	// Innermost middlewares, so the deadline is set right before the handler.
+	s.GetRouter().Use(middleware.Streaming(s.isStreaming, s.streamsContext))
+	s.GetRouter().Use(middleware.Timeout(s.routeTimeout, ErrRequesTimeout))
+
 	//////
 	// Validation.
 	//////
@@ -341,14 +601,29 @@ func New(name, address string, opts ...Option) (IServer, error) {
 		return nil, err
 	}
 
+	for _, hook := range s.startupHooks {
+		if err := validation.ValidateStruct(hook); err != nil {
+			return nil, err
+		}
+	}
+
 	//////
 	// Handlers.
 	//////
 
-	addHandler(s.GetRouter(), s.handlers...)
+	s.addHandler(s.handlers...)
+
+	if len(s.startupHooks) > 0 {
+		s.addHandler(handler.Startup(s.startupDeterminer))
+	}
 
+	// The server isn't ready until it finished starting up, and once it
+	// begins to shutdown.
 	if s.readinessDeterminers != nil && len(s.readinessDeterminers) > 0 {
-		addHandler(s.GetRouter(), handler.Readiness(s.readinessDeterminers...))
+		determiners := append([]*handler.ReadinessDeterminer{}, s.readinessDeterminers...)
+		determiners = append(determiners, s.startupDeterminer, s.shutdownDeterminer)
+
+		s.addHandler(handler.Readiness(determiners...))
 	}
 
 	//////
@@ -357,20 +632,51 @@ func New(name, address string, opts ...Option) (IServer, error) {
 
 	if s.EnableMetrics {
 		for _, m := range s.metrics {
-			m := m
+			if err := s.registry.Publish(m.Name, m.Value); err != nil {
+				return nil, err
+			}
+		}
+
+		// The server registry wins over the package-level one.
+		registries := []*metric.Registry{s.registry}
 
-			metric.Publish(m.Name, m.Value)
+		if s.EnableGlobalMetrics {
+			registries = append(registries, metric.Default())
 		}
 
 		// Gorilla Mux exp var route registration.
-		addHandler(s.GetRouter(), handler.Metrics())
+		s.addHandler(handler.Metrics(registries...))
+
+		if s.EnablePrometheus {
+			s.addHandler(handler.Prometheus(registries...))
+		}
+
+		if s.statsdAddress != "" {
+			if err := s.setupStatsD(registries); err != nil {
+				return nil, err
+			}
+		}
+
+		// Traces, and metrics share the telemetry pipeline.
+		if t, ok := s.GetTelemetry().(*telemetry.Telemetry); ok && s.meterProvider == nil && t.MeterProvider != nil {
+			s.meterProvider = t.MeterProvider
+		}
+
+		if s.meterProvider != nil {
+			otelBridge, err := metric.NewOTelBridge(s.meterProvider, registries...)
+			if err != nil {
+				return nil, err
+			}
+
+			s.otelBridge = otelBridge
+		}
 	}
 
 	return s, nil
 }
 
 // NewDefault returns a web server with observability:
-// - Metrics: `cmdline`, `memstats`, and `server`
+// - Metrics: `cmdline`, `go` (runtime), `memstats`, `process`, and `server`
 // - Telemetry: `stdout` provider
 // - Logging: `error`, no file
 // - Pre-loaded handlers (Liveness, OK, and Stop)
@@ -391,7 +697,9 @@ func NewDefault(name, address string) (IServer, error) {
 		WithHandlers(handler.Liveness(), handler.OK(), handler.Stop()),
 		WithMetrics(
 			metric.Metric{Name: "cmdline", Value: metric.CommandLine()},
+			metric.Metric{Name: "go", Value: metric.NewRuntimeCollector(metric.DefaultSamplingInterval)},
 			metric.Metric{Name: "memstats", Value: metric.MemoryStats()},
+			metric.Metric{Name: "process", Value: metric.NewProcessCollector(metric.DefaultSamplingInterval)},
 			metric.Metric{Name: "server", Value: metric.Server(address, name, os.Getpid())},
 		),
 		WithLogging(level.Error.String(), level.Error.String(), ""),
@@ -5,20 +5,43 @@
 package webserver
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/thalesfsp/randomness"
+	"github.com/thalesfsp/sypl/formatter"
+	"github.com/thalesfsp/sypl/level"
+	"github.com/thalesfsp/sypl/output"
 	"github.com/thalesfsp/webserver/handler"
 	"github.com/thalesfsp/webserver/metric"
+	"github.com/thalesfsp/webserver/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 const serverName = "test-server"
@@ -100,6 +123,7 @@ func setupTestServer(t *testing.T) (IServer, int) {
 				}
 			}),
 		}),
+		WithPrometheus(),
 		WithTimeout(3*time.Second, 1*time.Second, 3*time.Second, 10*time.Second, 3*time.Second),
 	)
 	if err != nil {
@@ -122,6 +146,52 @@ func setupTestServer(t *testing.T) (IServer, int) {
 	return testServer, int(port)
 }
 
+// Writes a self-signed certificate, and its key for `commonName` to `dir`.
+func writeCertificate(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
 //nolint:noctx
 func callAndExpect(t *testing.T, port int, url string, sc int, expectedBodyContains string) {
 	t.Helper()
@@ -231,6 +301,24 @@ func TestNew(t *testing.T) {
 				expectedBodyContains: `"simple_metric_example_counter": 2`,
 			},
 		},
+		{
+			name: "Should work - /metrics - counter",
+			args: args{
+				port:                 port,
+				url:                  "/api/v1/metrics",
+				sc:                   http.StatusOK,
+				expectedBodyContains: "\nsimple_metric_example_counter 2\n",
+			},
+		},
+		{
+			name: "Should work - /metrics - RED",
+			args: args{
+				port:                 port,
+				url:                  "/api/v1/metrics",
+				sc:                   http.StatusOK,
+				expectedBodyContains: `http_requests_total{method="GET",route="/api/v1/ok",status_class="2xx"} 1`,
+			},
+		},
 		{
 			name: "Should work - /slow",
 			args: args{
@@ -419,3 +507,1638 @@ func TestNewBasic(t *testing.T) {
 		})
 	}
 }
+
+func TestNew_tls(t *testing.T) {
+	dir := t.TempDir()
+
+	certFile, keyFile := writeCertificate(t, dir, "first")
+
+	port := generatePort(t)
+
+	testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", port),
+		WithHandlers(handler.Liveness()),
+		WithTLS(certFile, keyFile),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testServer.(*Server).TLS.ReloadInterval = 100 * time.Millisecond
+
+	go func() {
+		if err := testServer.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	defer func() {
+		if _, err := testServer.Shutdown(context.Background()); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// Ensures enough time for the server to be up, and ready - just for testing.
+	time.Sleep(200 * time.Millisecond)
+
+	// Returns the common name of the certificate served.
+	servedCommonName := func() string {
+		tlsClient := http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DisableKeepAlives: true,
+				//nolint:gosec
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}
+
+		//nolint:noctx
+		resp, err := tlsClient.Get(fmt.Sprintf("https://localhost:%d/liveness", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expect %v got %v", http.StatusOK, resp.StatusCode)
+		}
+
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	if cn := servedCommonName(); cn != "first" {
+		t.Fatalf("Expect %v got %v", "first", cn)
+	}
+
+	// Rotates the certificate.
+	writeCertificate(t, dir, "second")
+
+	later := time.Now().Add(time.Minute)
+
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	if cn := servedCommonName(); cn != "second" {
+		t.Fatalf("Expect %v got %v", "second", cn)
+	}
+}
+
+func TestNew_mtls(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, t.TempDir(), "server")
+	clientCertFile, clientKeyFile := writeCertificate(t, t.TempDir(), "client")
+
+	port := generatePort(t)
+
+	testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", port),
+		WithHandlers(handler.Handler{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				identity, ok := ClientIdentityFromContext(r.Context())
+				if !ok {
+					http.Error(w, "missing identity", http.StatusUnauthorized)
+
+					return
+				}
+
+				fmt.Fprintln(w, identity.Name())
+			}),
+			Method: http.MethodGet,
+			Path:   "/whoami",
+		}),
+		WithTLS(certFile, keyFile),
+		WithClientCA(clientCertFile),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := testServer.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	defer func() {
+		if _, err := testServer.Shutdown(context.Background()); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// Ensures enough time for the server to be up, and ready - just for testing.
+	time.Sleep(200 * time.Millisecond)
+
+	clientCertificate, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Calls `/whoami`, optionally presenting the client certificate.
+	whoami := func(certificates ...tls.Certificate) (string, error) {
+		tlsClient := http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				//nolint:gosec
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: certificates},
+			},
+		}
+
+		//nolint:noctx
+		resp, err := tlsClient.Get(fmt.Sprintf("https://localhost:%d/whoami", port))
+		if err != nil {
+			return "", err
+		}
+
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+
+		return strings.TrimSpace(string(body)), err
+	}
+
+	if _, err := whoami(); err == nil {
+		t.Fatal("Expected request without client certificate to fail")
+	}
+
+	name, err := whoami(clientCertificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "client" {
+		t.Fatalf("Expect %v got %v", "client", name)
+	}
+}
+
+func TestServer_StartContext(t *testing.T) {
+	// Two servers in the same process, stopped independently.
+	newServer := func() (IServer, int) {
+		port := int(generatePort(t))
+
+		s, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", port),
+			WithHandlers(handler.Liveness()),
+			WithTimeout(3*time.Second, 1*time.Second, 3*time.Second, 100*time.Millisecond, 3*time.Second),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return s, port
+	}
+
+	first, firstPort := newServer()
+	second, secondPort := newServer()
+
+	if _, err := first.Shutdown(context.Background()); err == nil {
+		t.Fatal("Expected error shutting down a server which was never started")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	firstResult := make(chan *ShutdownResult, 1)
+
+	go func() {
+		result, err := first.StartContext(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		firstResult <- result
+	}()
+
+	go func() {
+		if _, err := second.StartContext(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	// Ensures enough time for the server to be up, and ready - just for testing.
+	time.Sleep(200 * time.Millisecond)
+
+	callAndExpect(t, firstPort, "/liveness", http.StatusOK, http.StatusText(http.StatusOK))
+	callAndExpect(t, secondPort, "/liveness", http.StatusOK, http.StatusText(http.StatusOK))
+
+	cancel()
+
+	result := <-firstResult
+
+	if result.Cause != ShutdownCauseContext || !result.Graceful {
+		t.Fatalf("Unexpected shutdown result %+v", result)
+	}
+
+	// The second server is unaffected.
+	callAndExpect(t, secondPort, "/liveness", http.StatusOK, http.StatusText(http.StatusOK))
+
+	result, err := second.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Cause != ShutdownCauseShutdown || !result.Graceful {
+		t.Fatalf("Unexpected shutdown result %+v", result)
+	}
+}
+
+func TestServer_stopHandler(t *testing.T) {
+	// Two servers in the same process, only the called one stops.
+	newServer := func() (IServer, int, chan *ShutdownResult) {
+		port := int(generatePort(t))
+
+		s, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", port),
+			WithHandlers(handler.Liveness(), handler.Stop()),
+			WithTimeout(3*time.Second, 1*time.Second, 3*time.Second, 100*time.Millisecond, 3*time.Second),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results := make(chan *ShutdownResult, 1)
+
+		go func() {
+			result, err := s.StartContext(context.Background())
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			results <- result
+		}()
+
+		return s, port, results
+	}
+
+	first, firstPort, firstResults := newServer()
+	_, secondPort, secondResults := newServer()
+
+	// Ensures enough time for the server to be up, and ready - just for testing.
+	time.Sleep(200 * time.Millisecond)
+
+	callAndExpect(t, secondPort, "/stop", http.StatusOK, http.StatusText(http.StatusOK))
+
+	select {
+	case result := <-secondResults:
+		if result.Cause != ShutdownCauseStop || !result.Graceful {
+			t.Fatalf("Unexpected shutdown result %+v", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the server to stop")
+	}
+
+	// The first server is unaffected.
+	callAndExpect(t, firstPort, "/liveness", http.StatusOK, http.StatusText(http.StatusOK))
+
+	if _, err := first.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	<-firstResults
+
+	// Outside of a server, there's nothing to stop.
+	w := httptest.NewRecorder()
+
+	handler.Stop().Handler(w, httptest.NewRequest(http.MethodGet, "/stop", nil))
+
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("Expected %d, got %d", http.StatusNotImplemented, w.Code)
+	}
+}
+
+func TestServer_RegisterShutdownTask(t *testing.T) {
+	port := generatePort(t)
+
+	testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", port),
+		WithTimeout(3*time.Second, 1*time.Second, 3*time.Second, 200*time.Millisecond, 3*time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := []string{}
+	orderMutex := sync.Mutex{}
+	errFlush := errors.New("flush failed")
+
+	// Records the task execution order.
+	record := func(name string) {
+		orderMutex.Lock()
+		defer orderMutex.Unlock()
+
+		order = append(order, name)
+	}
+
+	registered := []struct {
+		name     string
+		priority int
+		fn       ShutdownTaskFunc
+	}{
+		{"telemetry", 10, func(ctx context.Context) error { record("telemetry"); return nil }},
+		{"cache", 0, func(ctx context.Context) error { record("cache"); return errFlush }},
+		{"db", 5, func(ctx context.Context) error { record("db"); <-ctx.Done(); return nil }},
+	}
+
+	for _, task := range registered {
+		if err := testServer.RegisterShutdownTask(task.name, task.priority, task.fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := testServer.RegisterShutdownTask("", 0, nil); err == nil {
+		t.Fatal("Expected invalid task to fail")
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+
+		if err := testServer.Stop(os.Interrupt); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	result, err := testServer.StartContext(context.Background())
+	if err == nil {
+		t.Fatal("Expected shutdown error")
+	}
+
+	if !errors.Is(err, errFlush) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected task errors to be aggregated, got %v", err)
+	}
+
+	if result.Cause != ShutdownCauseStop || len(result.Tasks) != 3 {
+		t.Fatalf("Unexpected shutdown result %+v", result)
+	}
+
+	orderMutex.Lock()
+	defer orderMutex.Unlock()
+
+	// `db` blocks until the deadline, so `telemetry` never runs.
+	if strings.Join(order, ",") != "cache,db" {
+		t.Fatalf("Expect %v got %v", "cache,db", order)
+	}
+}
+
+func TestNew_startupHooks(t *testing.T) {
+	port := int(generatePort(t))
+
+	warmedUp := make(chan struct{})
+
+	testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", port),
+		WithTimeout(3*time.Second, 1*time.Second, 3*time.Second, 100*time.Millisecond, 3*time.Second),
+		WithHandlers(handler.Liveness(), handler.OK()),
+		WithMetrics(),
+		WithStartupHooks(
+			StartupHook{
+				Name:    "cache",
+				Timeout: 5 * time.Second,
+				Func: func(ctx context.Context) error {
+					<-warmedUp
+
+					return nil
+				},
+			},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if _, err := testServer.StartContext(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	// Ensures enough time for the server to be up, and ready - just for testing.
+	time.Sleep(200 * time.Millisecond)
+
+	callAndExpect(t, port, "/startup", http.StatusServiceUnavailable, "cache")
+
+	// Only probes are served during warm-up.
+	callAndExpect(t, port, "/liveness", http.StatusOK, http.StatusText(http.StatusOK))
+	callAndExpect(t, port, "/", http.StatusServiceUnavailable, "server is starting")
+
+	close(warmedUp)
+
+	time.Sleep(100 * time.Millisecond)
+
+	callAndExpect(t, port, "/startup", http.StatusOK, http.StatusText(http.StatusOK))
+	callAndExpect(t, port, "/", http.StatusOK, http.StatusText(http.StatusOK))
+
+	// Warm-up replies are counted.
+	if v := testServer.GetRegistry().Get("http_requests_total").(*metric.CounterVec).WithLabelValues(http.MethodGet, "/", "5xx").Value(); v != 1 {
+		t.Errorf("Expected 1 warm-up reply, got %d", v)
+	}
+
+	if _, err := testServer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed hook stops the server.
+	failingServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)),
+		WithTimeout(3*time.Second, 1*time.Second, 3*time.Second, 100*time.Millisecond, 3*time.Second),
+		WithStartupHooks(
+			StartupHook{
+				Name:    "migrations",
+				Timeout: 100 * time.Millisecond,
+				Func: func(ctx context.Context) error {
+					<-ctx.Done()
+
+					return ctx.Err()
+				},
+			},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := failingServer.StartContext(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "migrations") {
+		t.Fatalf("Expected startup hook error, got %v", err)
+	}
+
+	if result.Cause != ShutdownCauseStartup {
+		t.Fatalf("Expect %v got %v", ShutdownCauseStartup, result.Cause)
+	}
+}
+
+func TestServer_Shutdown_drainPeriod(t *testing.T) {
+	port := int(generatePort(t))
+
+	readinessFlag := handler.NewReadinessDeterminer("db")
+	readinessFlag.SetReadiness(true)
+
+	testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", port),
+		WithHandlers(handler.Liveness()),
+		WithReadiness(readinessFlag),
+		WithShutdownDrainPeriod(500*time.Millisecond),
+		WithTimeout(3*time.Second, 1*time.Second, 3*time.Second, 100*time.Millisecond, 3*time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if _, err := testServer.StartContext(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	// Ensures enough time for the server to be up, and ready - just for testing.
+	time.Sleep(200 * time.Millisecond)
+
+	callAndExpect(t, port, "/readiness", http.StatusOK, http.StatusText(http.StatusOK))
+
+	shutdownDone := make(chan struct{})
+
+	go func() {
+		defer close(shutdownDone)
+
+		if _, err := testServer.Shutdown(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+
+	// Not ready, but still serving during the drain period.
+	callAndExpect(t, port, "/readiness", http.StatusServiceUnavailable, "shutdown")
+	callAndExpect(t, port, "/liveness", http.StatusOK, http.StatusText(http.StatusOK))
+
+	<-shutdownDone
+}
+
+func TestServer_Shutdown_sseStream(t *testing.T) {
+	port := int(generatePort(t))
+
+	broker := handler.NewEventBroker(10)
+
+	testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", port),
+		WithHandlers(handler.SSE("/events", broker.Subscribe)),
+		WithTimeout(3*time.Second, 1*time.Second, 3*time.Second, 100*time.Millisecond, 3*time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if _, err := testServer.StartContext(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	// Ensures enough time for the server to be up, and ready - just for testing.
+	time.Sleep(200 * time.Millisecond)
+
+	resp, err := c.Get(fmt.Sprintf("http://0.0.0.0:%d/events", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	broker.Publish(handler.Event{Data: "first"})
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(line, "id:") && !strings.HasPrefix(line, "data:") {
+		t.Fatalf("Expected an event, got %q", line)
+	}
+
+	// The open stream doesn't hold the shutdown.
+	result, err := testServer.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Graceful || result.Duration >= 3*time.Second {
+		t.Fatalf("Expected a graceful shutdown, got %+v", result)
+	}
+}
+
+func TestNew_routeTimeout(t *testing.T) {
+	port := int(generatePort(t))
+
+	// Sleeps longer than the server request timeout.
+	sleepy := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+
+		_, hasDeadline := r.Context().Deadline()
+
+		fmt.Fprintf(w, "deadline=%v\n", hasDeadline)
+	}
+
+	testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", port),
+		WithHandlers(
+			handler.Handler{Handler: sleepy, Method: http.MethodGet, Path: "/default"},
+			handler.Handler{Handler: sleepy, Method: http.MethodGet, Path: "/report", Timeout: 2 * time.Second},
+			handler.Handler{Handler: sleepy, Method: http.MethodGet, Path: "/unbounded", Timeout: handler.NoTimeout},
+		),
+		WithTimeout(3*time.Second, 100*time.Millisecond, 3*time.Second, 100*time.Millisecond, 3*time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if _, err := testServer.StartContext(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	defer func() {
+		if _, err := testServer.Shutdown(context.Background()); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// Ensures enough time for the server to be up, and ready - just for testing.
+	time.Sleep(200 * time.Millisecond)
+
+	callAndExpect(t, port, "/default", ErrRequesTimeout.StatusCode, fmt.Sprintf(`"message":%q`, ErrRequesTimeout.Error()))
+	callAndExpect(t, port, "/report", http.StatusOK, "deadline=true")
+	callAndExpect(t, port, "/unbounded", http.StatusOK, "deadline=false")
+}
+
+func TestNew_streaming(t *testing.T) {
+	port := int(generatePort(t))
+
+	// Streams events for longer than the server timeouts.
+	sse := func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "flusher not supported", http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for i := 0; i < 5; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+
+			flusher.Flush()
+
+			select {
+			case <-time.After(50 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	// Echoes a line over the raw connection, after the server timeouts.
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "hijacker not supported", http.StatusInternalServerError)
+
+			return
+		}
+
+		conn, rw, err := hijacker.Hijack()
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		fmt.Fprint(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+
+		if err := rw.Flush(); err != nil {
+			return
+		}
+
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		time.Sleep(200 * time.Millisecond)
+
+		fmt.Fprint(rw, line)
+
+		_ = rw.Flush()
+	}
+
+	testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", port),
+		WithHandlers(
+			handler.Handler{Handler: sse, Method: http.MethodGet, Path: "/events", Streaming: true},
+			handler.Handler{Handler: echo, Method: http.MethodGet, Path: "/echo", Streaming: true},
+		),
+		WithTimeout(150*time.Millisecond, 100*time.Millisecond, 3*time.Second, 100*time.Millisecond, 150*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if _, err := testServer.StartContext(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	defer func() {
+		if _, err := testServer.Shutdown(context.Background()); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// Ensures enough time for the server to be up, and ready - just for testing.
+	time.Sleep(200 * time.Millisecond)
+
+	t.Run("Should stream SSE events", func(t *testing.T) {
+		resp, err := c.Get(fmt.Sprintf("http://0.0.0.0:%d/events", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Count(string(body), "data: "); got != 5 {
+			t.Fatalf("Expected 5 events, got %d: %q", got, body)
+		}
+	})
+
+	t.Run("Should hijack the connection", func(t *testing.T) {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer conn.Close()
+
+		if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		fmt.Fprint(conn, "GET /echo HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+
+		reader := bufio.NewReader(conn)
+
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("Expected status code %d, got %d", http.StatusSwitchingProtocols, resp.StatusCode)
+		}
+
+		// Waits past the server timeouts before talking.
+		time.Sleep(200 * time.Millisecond)
+
+		fmt.Fprint(conn, "ping\n")
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != "ping\n" {
+			t.Fatalf("Expected echo %q, got %q", "ping\n", line)
+		}
+	})
+}
+
+func TestServer_webSocket(t *testing.T) {
+	port := int(generatePort(t))
+
+	hub := handler.NewHub()
+
+	echo := func(conn *handler.WebSocketConn, messageType int, data []byte) {
+		if err := conn.Send(messageType, data); err != nil {
+			t.Error(err)
+		}
+	}
+
+	testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", port),
+		WithHub(hub),
+		WithHandlers(handler.WebSocket("/ws", hub, echo, handler.WithWebSocketOnConnect(func(conn *handler.WebSocketConn) {
+			conn.Join(conn.Request().URL.Query().Get("room"))
+		}))),
+		WithTimeout(3*time.Second, 100*time.Millisecond, 3*time.Second, 100*time.Millisecond, 3*time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if testServer.GetHub() != hub {
+		t.Fatal("Expected server to use the provided hub")
+	}
+
+	go func() {
+		if _, err := testServer.StartContext(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	// Ensures enough time for the server to be up, and ready - just for testing.
+	time.Sleep(200 * time.Millisecond)
+
+	dial := func(room string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://127.0.0.1:%d/ws?room=%s", port, room), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		return conn
+	}
+
+	expectMessage := func(conn *websocket.Conn, want string) {
+		t.Helper()
+
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != want {
+			t.Fatalf("Expected message %q, got %q", want, data)
+		}
+	}
+
+	jobs := dial("jobs")
+	defer jobs.Close()
+
+	other := dial("other")
+	defer other.Close()
+
+	if err := jobs.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	expectMessage(jobs, "ping")
+
+	if hub.Len() != 2 {
+		t.Fatalf("Expected 2 connections, got %d", hub.Len())
+	}
+
+	hub.BroadcastTo("jobs", handler.TextMessage, []byte("job done"))
+	hub.Broadcast(handler.TextMessage, []byte("hello"))
+
+	expectMessage(jobs, "job done")
+	expectMessage(jobs, "hello")
+	expectMessage(other, "hello")
+
+	// Clients reply to the close frame in their read loop.
+	closeCodes := make(chan int, 2)
+
+	for _, conn := range []*websocket.Conn{jobs, other} {
+		go func(conn *websocket.Conn) {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					var closeErr *websocket.CloseError
+					if errors.As(err, &closeErr) {
+						closeCodes <- closeErr.Code
+					} else {
+						closeCodes <- -1
+					}
+
+					return
+				}
+			}
+		}(conn)
+	}
+
+	result, err := testServer.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Graceful {
+		t.Fatal("Expected graceful shutdown")
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := <-closeCodes; code != websocket.CloseGoingAway {
+			t.Fatalf("Expected close code %d, got %d", websocket.CloseGoingAway, code)
+		}
+	}
+
+	if hub.Len() != 0 {
+		t.Fatalf("Expected no connections, got %d", hub.Len())
+	}
+
+	// A restarted server accepts connections again.
+	go func() {
+		if _, err := testServer.StartContext(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+
+	restarted := dial("jobs")
+	defer restarted.Close()
+
+	if err := restarted.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	expectMessage(restarted, "ping")
+
+	if _, err := testServer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNew_metricsRegistry(t *testing.T) {
+	newServer := func() IServer {
+		testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)),
+			WithMetrics(metric.Metric{Name: "server", Value: metric.Server("0.0.0.0", serverName, os.Getpid())}),
+			WithGlobalMetrics(false),
+			WithHandlers(handler.OK()),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return testServer
+	}
+
+	// Same metric names, in the same process.
+	first, second := newServer(), newServer()
+
+	if first.GetRegistry() == second.GetRegistry() {
+		t.Fatal("Expected servers to have their own registry")
+	}
+
+	if first.GetRegistry().Get("http_requests_total") == nil {
+		t.Fatal("Expected HTTP metrics to be published in the server registry")
+	}
+
+	if err := first.GetRegistry().Publish("server", new(metric.Int)); !errors.Is(err, metric.ErrAlreadyPublished) {
+		t.Fatalf("Expected %v, got %v", metric.ErrAlreadyPublished, err)
+	}
+
+	// Requests without a matching route are recorded too.
+	for method, path := range map[string]string{http.MethodGet: "/nope", http.MethodPost: "/"} {
+		w := httptest.NewRecorder()
+
+		first.GetRouter().ServeHTTP(w, httptest.NewRequest(method, path, nil))
+
+		if w.Code != http.StatusNotFound && w.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("Expected 404, or 405 got %d", w.Code)
+		}
+	}
+
+	requests := first.GetRegistry().Get("http_requests_total").String()
+
+	for _, want := range []string{`"method":"GET","route":"unmatched"`, `"method":"POST","route":"unmatched"`} {
+		if !strings.Contains(requests, want) {
+			t.Fatalf("Expected %s in %s", want, requests)
+		}
+	}
+}
+
+func TestServer_statsD(t *testing.T) {
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	// Only the final flush is sent.
+	testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)),
+		WithGlobalMetrics(false),
+		WithStatsD(listener.LocalAddr().String(), metric.WithStatsDPrefix("app"), metric.WithStatsDInterval(time.Hour)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := new(metric.Int)
+
+	if err := testServer.GetRegistry().Publish("jobs", jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flushed after other tasks, so their metrics are included.
+	if err := testServer.RegisterShutdownTask("jobs", 0, func(ctx context.Context) error {
+		jobs.Set(7)
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+
+		if err := testServer.Stop(os.Interrupt); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	if _, err := testServer.StartContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Metrics may span multiple packets.
+	received := []string{}
+	buf := make([]byte, 65535)
+
+	for {
+		if err := listener.SetReadDeadline(time.Now().Add(200 * time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := listener.Read(buf)
+		if err != nil {
+			break
+		}
+
+		received = append(received, strings.Split(string(buf[:n]), "\n")...)
+	}
+
+	if !strings.Contains(strings.Join(received, "\n"), "app.jobs:7|g") {
+		t.Fatalf("Expected final flush to include jobs, got %q", received)
+	}
+
+	// The exporter was closed, a restarted server pushes again.
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+
+		if err := testServer.Stop(os.Interrupt); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	if _, err := testServer.StartContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := listener.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := listener.Read(buf); err != nil || !strings.Contains(string(buf[:n]), "app.jobs:7|g") {
+		t.Fatalf("Expected the restarted server to push jobs, got %q, %v", buf[:n], err)
+	}
+}
+
+// Records exported spans, and whether it was shutdown. Exports fail with
+// `err`, if any.
+type recordingExporter struct {
+	m        sync.Mutex
+	names    []string
+	shutdown bool
+	err      error
+}
+
+func (e *recordingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	for _, s := range spans {
+		e.names = append(e.names, s.Name())
+	}
+
+	return e.err
+}
+
+func (e *recordingExporter) Shutdown(ctx context.Context) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.shutdown = true
+
+	return nil
+}
+
+func TestServer_telemetryShutdown(t *testing.T) {
+	errExporter := errors.New("exporter failed")
+
+	tests := []struct {
+		name     string
+		err      error
+		shutdown bool
+	}{
+		{name: "flush"},
+		{name: "shutdown", shutdown: true},
+		{name: "exporter failed", err: errExporter, shutdown: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := &recordingExporter{err: tt.err}
+
+			// Spans are only exported when flushed.
+			provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(time.Hour)))
+
+			testTelemetry, err := telemetry.New(serverName, provider)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			options := []Option{WithTelemetry(testTelemetry)}
+
+			// Shutdown by default.
+			if !tt.shutdown {
+				options = append(options, WithTelemetryShutdown(false))
+			}
+
+			testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)), options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Spans of other tasks are also exported.
+			if err := testServer.RegisterShutdownTask("cache", 0, func(ctx context.Context) error {
+				_, span := provider.Tracer("test").Start(ctx, "flush cache")
+				span.End()
+
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			go func() {
+				time.Sleep(300 * time.Millisecond)
+
+				if err := testServer.Stop(os.Interrupt); err != nil {
+					log.Fatal(err)
+				}
+			}()
+
+			_, err = testServer.StartContext(context.Background())
+
+			if tt.err == nil && err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("Expected %v, got %v", tt.err, err)
+			}
+
+			// Only flushed, spans are still exported afterwards.
+			if !tt.shutdown {
+				_, span := provider.Tracer("test").Start(context.Background(), "after stop")
+				span.End()
+
+				if err := testTelemetry.ForceFlush(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want := "flush cache"
+
+			if !tt.shutdown {
+				want += ",after stop"
+			}
+
+			exporter.m.Lock()
+			defer exporter.m.Unlock()
+
+			if exporter.shutdown != tt.shutdown || strings.Join(exporter.names, ",") != want {
+				t.Errorf("Expected %s spans to be exported, and the exporter shutdown %v, got %v, %v", want, tt.shutdown, exporter.names, exporter.shutdown)
+			}
+		})
+	}
+}
+
+func TestNew_telemetryInMemory(t *testing.T) {
+	testTelemetry, recorder, err := telemetry.InMemoryProvider(serverName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testServer IServer
+
+	traced, err := handler.New(http.MethodGet, "/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := testServer.GetTelemetry().NewTracer("users").Start(r.Context(), "load user")
+		defer span.End()
+
+		span.SetAttributes(attribute.String("user.id", mux.Vars(r)["id"]))
+
+		w.WriteHeader(http.StatusOK)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testServer, err = New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)),
+		WithTelemetry(testTelemetry),
+		WithHandlers(traced),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+
+	testServer.GetRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// Named after the route template.
+	server, ok := recorder.FindSpan("/users/{id}")
+	if !ok {
+		t.Fatalf("Expected the server span, got %v", recorder.Spans())
+	}
+
+	if err := telemetry.AssertAttributes(server, attribute.String("http.method", http.MethodGet)); err != nil {
+		t.Fatal(err)
+	}
+
+	children := recorder.Children(server)
+
+	if len(children) != 1 || children[0].Name() != "load user" {
+		t.Fatalf("Expected the load user span to be a child of the server span, got %v", children)
+	}
+
+	if err := telemetry.AssertAttributes(children[0], attribute.String("user.id", "42")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNew_traceCorrelation(t *testing.T) {
+	testTelemetry, recorder, err := telemetry.InMemoryProvider(serverName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logged, err := handler.New(http.MethodGet, "/logged", func(w http.ResponseWriter, r *http.Request) {
+		l, ok := LoggerFromContext(r.Context())
+		if !ok {
+			http.Error(w, "missing request logger", http.StatusInternalServerError)
+
+			return
+		}
+
+		l.Infoln("handled")
+
+		w.WriteHeader(http.StatusOK)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)),
+		WithLogging("none", "info", ""),
+		WithTelemetry(testTelemetry),
+		WithHandlers(logged),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+
+	testServer.GetLogger().AddOutputs(output.New("Buffer", level.Trace, buf).SetFormatter(formatter.Text()))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/logged", nil)
+
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	testServer.GetRouter().ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	server, ok := recorder.FindSpan("/logged")
+	if !ok {
+		t.Fatalf("Expected the server span, got %v", recorder.Spans())
+	}
+
+	spanID := server.SpanContext().SpanID().String()
+
+	for header, expected := range map[string]string{
+		"X-Trace-Id":  traceID,
+		"X-Span-Id":   spanID,
+		"traceparent": "00-" + traceID + "-" + spanID + "-01",
+	} {
+		if got := w.Header().Get(header); got != expected {
+			t.Errorf("Expected %s header %q, got %q", header, expected, got)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected the handler, and access log lines, got %q", buf.String())
+	}
+
+	if !strings.Contains(lines[1], `"GET /logged HTTP/1.1" 200`) {
+		t.Errorf("Expected the access log line, got %q", lines[1])
+	}
+
+	for _, line := range lines {
+		if !strings.Contains(line, "trace_id="+traceID) || !strings.Contains(line, "span_id="+spanID) {
+			t.Errorf("Expected trace, and span IDs fields, got %q", line)
+		}
+	}
+}
+
+func TestNew_traceHeadersDisabled(t *testing.T) {
+	testTelemetry, _, err := telemetry.InMemoryProvider(serverName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)),
+		WithTelemetry(testTelemetry),
+		WithTraceHeaders("X-Request-Trace", "", false),
+		WithHandlers(handler.OK()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+
+	testServer.GetRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Header().Get("X-Request-Trace") == "" {
+		t.Error("Expected the trace ID header")
+	}
+
+	for _, header := range []string{"X-Trace-Id", "X-Span-Id", "traceparent"} {
+		if got := w.Header().Get(header); got != "" {
+			t.Errorf("Expected no %s header, got %q", header, got)
+		}
+	}
+}
+
+func TestServer_httpClient(t *testing.T) {
+	// Downstream service, unavailable for the first `failures` requests,
+	// asking to retry after `retryAfter`, if set.
+	newDownstream := func(t *testing.T, failures int32, retryAfter string, delay time.Duration) (*httptest.Server, *int32, chan string) {
+		t.Helper()
+
+		var calls int32
+
+		traceparents := make(chan string, 10)
+
+		downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case traceparents <- r.Header.Get("traceparent"):
+			default:
+			}
+
+			if atomic.AddInt32(&calls, 1) <= failures {
+				if retryAfter != "" {
+					w.Header().Set("Retry-After", retryAfter)
+				}
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+
+			fmt.Fprint(w, "downstream")
+		}))
+
+		t.Cleanup(downstream.Close)
+
+		return downstream, &calls, traceparents
+	}
+
+	t.Run("traced, retried, and measured", func(t *testing.T) {
+		downstream, calls, traceparents := newDownstream(t, 1, "", 0)
+
+		testTelemetry, recorder, err := telemetry.InMemoryProvider(serverName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var testServer IServer
+
+		proxy, err := handler.New(http.MethodGet, "/proxy", func(w http.ResponseWriter, r *http.Request) {
+			req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, downstream.URL, nil)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+
+				return
+			}
+
+			resp, err := testServer.NewHTTPClient(WithClientRetries(2, time.Millisecond)).Do(req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+
+				return
+			}
+
+			defer resp.Body.Close()
+
+			w.WriteHeader(resp.StatusCode)
+
+			_, _ = io.Copy(w, resp.Body)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testServer, err = New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)),
+			WithTelemetry(testTelemetry),
+			WithMetrics(),
+			WithHandlers(proxy),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/proxy", nil)
+
+		r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+		testServer.GetRouter().ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK || w.Body.String() != "downstream" {
+			t.Fatalf("Expected %d downstream, got %d %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		if n := atomic.LoadInt32(calls); n != 2 {
+			t.Fatalf("Expected 2 attempts, got %d", n)
+		}
+
+		// Every attempt propagates the inbound trace.
+		for i := 0; i < 2; i++ {
+			if traceparent := <-traceparents; !strings.Contains(traceparent, traceID) {
+				t.Errorf("Expected traceparent of trace %s, got %q", traceID, traceparent)
+			}
+		}
+
+		server, ok := recorder.FindSpan("/proxy")
+		if !ok {
+			t.Fatalf("Expected the server span, got %v", recorder.Spans())
+		}
+
+		if children := recorder.Children(server); len(children) != 2 {
+			t.Errorf("Expected a client span per attempt, got %v", children)
+		}
+
+		host := strings.TrimPrefix(downstream.URL, "http://")
+
+		for name, expected := range map[string]int64{
+			"http_client_requests_total":       1,
+			"http_client_retries_total":        1,
+			"http_client_request_errors_total": 0,
+		} {
+			labels := []string{http.MethodGet, host}
+
+			if name == "http_client_requests_total" {
+				labels = append(labels, "2xx")
+			}
+
+			v := testServer.GetRegistry().Get(name).(*metric.CounterVec).WithLabelValues(labels...).Value()
+
+			if v != expected {
+				t.Errorf("Expected %s %d, got %d", name, expected, v)
+			}
+		}
+	})
+
+	t.Run("non idempotent requests aren't retried", func(t *testing.T) {
+		downstream, calls, _ := newDownstream(t, 1, "", 0)
+
+		testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, downstream.URL, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := testServer.NewHTTPClient(WithClientRetries(2, time.Millisecond)).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+		}
+
+		if n := atomic.LoadInt32(calls); n != 1 {
+			t.Errorf("Expected 1 attempt, got %d", n)
+		}
+	})
+
+	t.Run("the inbound deadline takes precedence", func(t *testing.T) {
+		downstream, _, _ := newDownstream(t, 0, "", time.Second)
+
+		testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, downstream.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		began := time.Now()
+
+		if _, err := testServer.NewHTTPClient(WithClientRetries(2, time.Millisecond)).Do(req); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+		}
+
+		if elapsed := time.Since(began); elapsed > 500*time.Millisecond {
+			t.Errorf("Expected the request to be bounded by the deadline, took %s", elapsed)
+		}
+	})
+
+	t.Run("Retry-After is honoured", func(t *testing.T) {
+		testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The backoff alone would wait up to an hour.
+		client := testServer.NewHTTPClient(WithClientRetries(2, time.Hour), WithClientMaxBackoff(time.Hour))
+
+		downstream, calls, _ := newDownstream(t, 1, "0", 0)
+
+		resp, err := client.Get(downstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || atomic.LoadInt32(calls) != 2 {
+			t.Errorf("Expected %d after 2 attempts, got %d after %d", http.StatusOK, resp.StatusCode, atomic.LoadInt32(calls))
+		}
+
+		// Not retried if the wait outlives the deadline.
+		downstream, calls, _ = newDownstream(t, 1, "120", 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, downstream.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err = client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(calls) != 1 {
+			t.Errorf("Expected %d after 1 attempt, got %d after %d", http.StatusServiceUnavailable, resp.StatusCode, atomic.LoadInt32(calls))
+		}
+
+		// Nor if it's longer than the max backoff.
+		downstream, calls, _ = newDownstream(t, 1, "3600", 0)
+
+		began := time.Now()
+
+		resp, err = testServer.NewHTTPClient().Get(downstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(calls) != 1 || time.Since(began) > time.Second {
+			t.Errorf("Expected %d after 1 attempt, got %d after %d, in %s", http.StatusServiceUnavailable, resp.StatusCode, atomic.LoadInt32(calls), time.Since(began))
+		}
+	})
+
+	t.Run("bounded backoff", func(t *testing.T) {
+		testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range []struct {
+			failures int32
+			opts     []ClientOption
+		}{
+			// Negative backoff.
+			{failures: 2, opts: []ClientOption{WithClientRetries(2, -time.Second)}},
+
+			// The backoff of late attempts overflows, if not capped.
+			{failures: 69, opts: []ClientOption{WithClientRetries(70, time.Millisecond), WithClientMaxBackoff(time.Millisecond)}},
+		} {
+			downstream, calls, _ := newDownstream(t, tt.failures, "", 0)
+
+			resp, err := testServer.NewHTTPClient(tt.opts...).Get(downstream.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK || atomic.LoadInt32(calls) != tt.failures+1 {
+				t.Errorf("Expected %d after %d attempts, got %d after %d", http.StatusOK, tt.failures+1, resp.StatusCode, atomic.LoadInt32(calls))
+			}
+		}
+	})
+
+	t.Run("no attempt timeout", func(t *testing.T) {
+		downstream, _, _ := newDownstream(t, 0, "", 50*time.Millisecond)
+
+		testServer, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := testServer.NewHTTPClient(WithClientTimeout(0)).Get(downstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+	})
+}
+
+func TestNew_propagators(t *testing.T) {
+	if _, err := New(serverName, fmt.Sprintf("0.0.0.0:%d", generatePort(t)),
+		WithPropagators("tracecontext", "zipkin"),
+	); err == nil {
+		t.Fatal("Expected error for unknown propagator")
+	}
+}